@@ -0,0 +1,158 @@
+package opentick
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// AstAlterTable represents a parsed `ALTER TABLE db.tbl ...` statement. Only
+// one of AddCol, DropCol or RenameFrom/RenameTo is set per statement, the
+// same way AstCreateTable.Cols mixes column definitions with the PRIMARY
+// KEY clause.
+type AstAlterTable struct {
+	Name       *AstTableName
+	AddCol     *AstColumnDef
+	DropCol    *string
+	RenameFrom *string
+	RenameTo   *string
+}
+
+// AlterTable applies an ALTER TABLE statement against an existing table's
+// scheme. ADD COLUMN and RENAME COLUMN are supported for any column; DROP
+// COLUMN only ever targets a value column not referenced by any index,
+// since removing a key column would change the table's row identity and a
+// dropped column would leave a stale reference behind in the index. The
+// scheme is rewritten atomically at the current schemeVersion. Existing rows
+// are not rewritten: a column added after a row was written reads back as
+// its type's zero value (see decodeRowValues), and a dropped column's slot
+// is no longer read.
+func AlterTable(s Storage, dbName string, ast *AstAlterTable) (err error) {
+	if dbName == "" {
+		dbName = ast.Name.DatabaseName()
+	}
+	tblName := ast.Name.TableName()
+	_, dirScheme, err1 := openTable(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		tbl := decodeTableScheme(tr.Get(dirScheme.Bytes()))
+		switch {
+		case ast.AddCol != nil:
+			err = addColumn(&tbl, ast.AddCol)
+		case ast.DropCol != nil:
+			err = dropColumn(&tbl, *ast.DropCol)
+		case ast.RenameFrom != nil:
+			err = renameColumn(&tbl, *ast.RenameFrom, *ast.RenameTo)
+		default:
+			err = errors.New("ALTER TABLE statement carries no operation")
+		}
+		if err != nil {
+			return
+		}
+		tbl.fill()
+		tr.Set(dirScheme.Bytes(), tbl.encode())
+		return
+	})
+	if err == nil {
+		s.SchemeCache().Delete(dbName + "." + tblName)
+	}
+	return
+}
+
+func addColumn(tbl *TableScheme, col *AstColumnDef) error {
+	if _, ok := tbl.NameMap[*col.Name]; ok {
+		return errors.New("Multiple definition of identifier " + *col.Name)
+	}
+	t := parseDataType(*col.Type)
+	if t == UnknowDataType {
+		return errors.New("Unknown type " + *col.Type)
+	}
+	def := NewTableColDef(*col.Name, t)
+	def.AddedVersion = schemeVersion
+	tbl.Cols = append(tbl.Cols, def)
+	return nil
+}
+
+// dropColumn marks name's TableColDef as dropped in place rather than
+// cutting it out of tbl.Cols. Removing it from the slice would shift every
+// later column's Pos (and PosCol, which index.go's encoded column
+// references are keyed on) down by one, so rows written before the drop
+// would decode with the wrong bytes for whatever column used to come after
+// it. fill(), called by the caller after dropColumn returns, is what
+// actually excludes the dropped column from Value/NameMap.
+func dropColumn(tbl *TableScheme, name string) error {
+	col, ok := tbl.NameMap[name]
+	if !ok {
+		return errors.New("Unknown definition " + name)
+	}
+	if col.IsKey {
+		return errors.New("Cannot drop key column " + name)
+	}
+	for _, idx := range tbl.Indexes {
+		for _, c := range idx.Cols {
+			if c.Name == name {
+				return errors.New("Cannot drop column " + name + ": referenced by index " + idx.Name)
+			}
+		}
+	}
+	col.Dropped = true
+	return nil
+}
+
+func renameColumn(tbl *TableScheme, from string, to string) error {
+	if _, ok := tbl.NameMap[from]; !ok {
+		return errors.New("Unknown definition " + from)
+	}
+	if _, ok := tbl.NameMap[to]; ok {
+		return errors.New("Multiple definition of identifier " + to)
+	}
+	for i := range tbl.Cols {
+		if tbl.Cols[i].Name == from {
+			tbl.Cols[i].Name = to
+			break
+		}
+	}
+	return nil
+}
+
+// Migrate walks every table of dbName and rewrites any table whose stored
+// scheme predates the current schemeVersion in the current format (so it
+// carries AddedVersion tags and every later field), chunking
+// the work one table's scheme key at a time so a database with many tables
+// doesn't need one giant transaction.
+func Migrate(s Storage, dbName string) (upgraded int, err error) {
+	tables, err1 := ListTables(s, dbName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	for _, tblName := range tables {
+		_, dirScheme, err2 := openTable(s, dbName, tblName)
+		if err2 != nil {
+			err = err2
+			return
+		}
+		var did bool
+		_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+			raw := tr.Get(dirScheme.Bytes())
+			if binary.BigEndian.Uint32(raw) >= schemeVersion {
+				return
+			}
+			tbl := decodeTableScheme(raw)
+			tbl.fill()
+			tr.Set(dirScheme.Bytes(), tbl.encode())
+			did = true
+			return
+		})
+		if err != nil {
+			return
+		}
+		if did {
+			s.SchemeCache().Delete(dbName + "." + tblName)
+			upgraded++
+		}
+	}
+	return
+}
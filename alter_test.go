@@ -0,0 +1,103 @@
+package opentick
+
+import "testing"
+
+// TestDropColumnPreservesPositions exercises the chunk0-2 fix: dropping a
+// column must not shift the Pos of any column that comes after it, or a row
+// written before the drop decodes with the wrong bytes for that column.
+func TestDropColumnPreservesPositions(t *testing.T) {
+	cols := []TableColDef{
+		NewTableColDef("id", Int),
+		NewTableColDef("a", Text),
+		NewTableColDef("b", Text),
+		NewTableColDef("c", Text),
+	}
+	tbl := NewTableScheme(cols, []int{0})
+
+	_, _, oldValue, err := encodeRow(&tbl, map[string]interface{}{
+		"id": int64(1), "a": "a1", "b": "b1", "c": "c1",
+	})
+	if err != nil {
+		t.Fatalf("encodeRow: %v", err)
+	}
+
+	if err := dropColumn(&tbl, "b"); err != nil {
+		t.Fatalf("dropColumn: %v", err)
+	}
+	tbl.fill()
+
+	if _, ok := tbl.NameMap["b"]; ok {
+		t.Fatal("dropped column still resolvable by name")
+	}
+	if len(tbl.Value) != 2 {
+		t.Fatalf("len(tbl.Value) = %d, want 2", len(tbl.Value))
+	}
+
+	// The row written before the drop must still decode "a" and "c"
+	// correctly - not "c" reading back what used to be "b"'s bytes.
+	oldDecoded := decodeRowValues(&tbl, oldValue)
+	if oldDecoded["a"] != "a1" {
+		t.Fatalf("old row a = %v, want a1", oldDecoded["a"])
+	}
+	if oldDecoded["c"] != "c1" {
+		t.Fatalf("old row c = %v, want c1 (position corrupted by drop)", oldDecoded["c"])
+	}
+
+	// A row written after the drop must round-trip cleanly too.
+	_, _, newValue, err := encodeRow(&tbl, map[string]interface{}{
+		"id": int64(2), "a": "a2", "c": "c2",
+	})
+	if err != nil {
+		t.Fatalf("encodeRow after drop: %v", err)
+	}
+	newDecoded := decodeRowValues(&tbl, newValue)
+	if newDecoded["a"] != "a2" || newDecoded["c"] != "c2" {
+		t.Fatalf("new row decoded = %+v, want a=a2 c=c2", newDecoded)
+	}
+}
+
+func TestDropColumnRefusesKeyColumn(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	if err := dropColumn(&tbl, "id"); err == nil {
+		t.Fatal("expected error dropping a key column")
+	}
+}
+
+func TestDropColumnRefusesUnknownColumn(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	if err := dropColumn(&tbl, "nope"); err == nil {
+		t.Fatal("expected error dropping an unknown column")
+	}
+}
+
+func TestDropColumnRefusesIndexedColumn(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	tbl.Indexes = []IndexDef{{Name: "by_val", Cols: []*TableColDef{tbl.NameMap["val"]}}}
+	if err := dropColumn(&tbl, "val"); err == nil {
+		t.Fatal("expected error dropping a column referenced by an index")
+	}
+}
+
+func TestRenameColumn(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	if err := renameColumn(&tbl, "val", "value"); err != nil {
+		t.Fatalf("renameColumn: %v", err)
+	}
+	tbl.fill()
+	if _, ok := tbl.NameMap["val"]; ok {
+		t.Fatal("old column name still resolvable after rename")
+	}
+	if _, ok := tbl.NameMap["value"]; !ok {
+		t.Fatal("new column name not resolvable after rename")
+	}
+	if err := renameColumn(&tbl, "id", "value"); err == nil {
+		t.Fatal("expected error renaming to an already-used identifier")
+	}
+	if err := renameColumn(&tbl, "nope", "x"); err == nil {
+		t.Fatal("expected error renaming an unknown column")
+	}
+}
@@ -0,0 +1,213 @@
+package opentick
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// CDCOp identifies the kind of mutation a RowEvent describes.
+type CDCOp int
+
+const (
+	CDCInsert CDCOp = iota
+	CDCUpdate
+	CDCDelete
+)
+
+// RowEvent is one committed row mutation delivered by Subscribe, in the
+// order FoundationDB committed it.
+type RowEvent struct {
+	Op           CDCOp
+	Versionstamp []byte
+	Key          []interface{}
+	Value        []interface{}
+}
+
+// CancelFunc stops a Subscribe goroutine and closes its channel.
+type CancelFunc func()
+
+func cdcDirPath(dbName, tblName string) []string {
+	return []string{"db", dbName, tblName, "cdc"}
+}
+
+// EnableCDC turns change-data-capture on or off for a table. The
+// insert/delete transaction path only calls WriteCDCEvent for tables whose
+// scheme has this flag set, so turning it on is what makes
+// {"cdc"} start filling up.
+func EnableCDC(s Storage, dbName, tblName string, enable bool) (err error) {
+	_, dirScheme, err1 := openTable(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if enable {
+		if _, err = s.CreateDir(cdcDirPath(dbName, tblName)); err != nil {
+			return
+		}
+	}
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		tbl := decodeTableScheme(tr.Get(dirScheme.Bytes()))
+		tbl.CDCEnabled = enable
+		tr.Set(dirScheme.Bytes(), tbl.encode())
+		return
+	})
+	if err == nil {
+		s.SchemeCache().Delete(dbName + "." + tblName)
+	}
+	return
+}
+
+// cdcWatchKey is a single key per table, outside the range of any actual
+// event key (those all sort below cdcDir.Bytes()+0xFF), that WriteCDCEvent
+// bumps on every call so Subscribe has something to Watch that's actually
+// written to.
+func cdcWatchKey(cdcDir Dir) fdb.Key {
+	return fdb.Key(append(append([]byte{}, cdcDir.Bytes()...), 0xFF))
+}
+
+var cdcWatchBump = []byte{1, 0, 0, 0, 0, 0, 0, 0}
+
+// WriteCDCEvent records one row mutation for later delivery by Subscribe.
+// It must be called from inside the same FoundationDB transaction that
+// wrote or cleared the row itself (see row.go's InsertRow/DeleteRow), so a
+// subscriber never observes an event for a mutation that didn't actually
+// commit. The event is keyed by cdcDir followed by a raw 10-byte
+// versionstamp, which FoundationDB fills in with this transaction's commit
+// version, giving subscribers a total, gap-free order to tail. It also bumps
+// cdcWatchKey so a blocked Subscribe long-poll wakes up once this
+// transaction commits.
+func WriteCDCEvent(tr fdb.Transaction, cdcDir Dir, op CDCOp, key []interface{}, value []interface{}) {
+	// SetVersionstampedKey expects the key to end with the little-endian
+	// 4-byte offset of the 10-byte placeholder it overwrites.
+	k := append(append([]byte{}, cdcDir.Bytes()...), make([]byte, 10)...)
+	offset := make([]byte, 4)
+	binary.LittleEndian.PutUint32(offset, uint32(len(cdcDir.Bytes())))
+	k = append(k, offset...)
+	v := tuple.Tuple{int(op), tuple.Tuple(key), tuple.Tuple(value)}.Pack()
+	tr.SetVersionstampedKey(fdb.Key(k), v)
+	tr.Add(cdcWatchKey(cdcDir), cdcWatchBump)
+}
+
+// fdbTxnOf returns the real fdb.Transaction backing tr when tr is running
+// against a genuine FoundationDB Storage, so a caller like row.go can
+// conditionally call WriteCDCEvent: versionstamps are an FDB-only
+// primitive with no equivalent on bolt/leveldb/mem, so this is false for
+// every other backend.
+func fdbTxnOf(tr Txn) (fdb.Transaction, bool) {
+	ft, ok := tr.(*fdbTxn)
+	if !ok {
+		return fdb.Transaction{}, false
+	}
+	return ft.tr, true
+}
+
+func decodeCDCEvent(kv KeyValue) RowEvent {
+	versionstamp := kv.Key[len(kv.Key)-10:]
+	t, _ := tuple.Unpack(kv.Value)
+	ev := RowEvent{Versionstamp: versionstamp}
+	if len(t) > 0 {
+		ev.Op = CDCOp(t[0].(int64))
+	}
+	if len(t) > 1 {
+		if key, ok := t[1].(tuple.Tuple); ok {
+			ev.Key = []interface{}(key)
+		}
+	}
+	if len(t) > 2 {
+		if val, ok := t[2].(tuple.Tuple); ok {
+			ev.Value = []interface{}(val)
+		}
+	}
+	return ev
+}
+
+// Subscribe tails a table's change stream and delivers each committed
+// insert/update/delete as a RowEvent, in commit order, starting strictly
+// after fromVersionstamp (pass nil to start from the beginning of whatever
+// TrimCDC hasn't discarded yet). The returned channel is closed once the
+// CancelFunc is called, or when a read of the change stream fails.
+func Subscribe(db fdb.Transactor, dbName, tblName string, fromVersionstamp []byte) (<-chan RowEvent, CancelFunc, error) {
+	s := NewFDBStorage(db)
+	tbl, err := GetTableScheme(s, dbName, tblName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !tbl.CDCEnabled {
+		return nil, nil, errors.New("CDC is not enabled on table " + dbName + "." + tblName)
+	}
+	cdcDir, err := s.OpenDir(cdcDirPath(dbName, tblName))
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan RowEvent)
+	done := make(chan struct{})
+	cancel := CancelFunc(func() {
+		close(done)
+	})
+	go func() {
+		defer close(out)
+		begin := append([]byte{}, cdcDir.Bytes()...)
+		if len(fromVersionstamp) > 0 {
+			begin = append(append(append([]byte{}, cdcDir.Bytes()...), fromVersionstamp...), 0x00)
+		}
+		end := cdcWatchKey(cdcDir)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			var watch fdb.FutureNil
+			kvs, err := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+				kr := fdb.KeyRange{Begin: fdb.Key(begin), End: end}
+				got := tr.GetRange(kr, fdb.RangeOptions{Mode: fdb.StreamingModeWantAll}).GetSliceOrPanic()
+				watch = tr.Watch(end)
+				return got, nil
+			})
+			if err != nil {
+				return
+			}
+			for _, kv := range kvs.([]fdb.KeyValue) {
+				ev := decodeCDCEvent(KeyValue{Key: []byte(kv.Key), Value: kv.Value})
+				begin = append(append([]byte{}, []byte(kv.Key)...), 0x00)
+				select {
+				case out <- ev:
+				case <-done:
+					return
+				}
+			}
+			watchDone := make(chan error, 1)
+			go func() { watchDone <- watch.Get() }()
+			select {
+			case <-watchDone:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out, cancel, nil
+}
+
+// TrimCDC discards every recorded row event for a table strictly older
+// than `before`, so long-lived CDC subspaces don't grow without bound once
+// every subscriber has moved past that point.
+func TrimCDC(db fdb.Transactor, dbName, tblName string, before []byte) (err error) {
+	s := NewFDBStorage(db)
+	cdcDir, err1 := s.OpenDir(cdcDirPath(dbName, tblName))
+	if err1 != nil {
+		err = err1
+		return
+	}
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		begin := cdcDir.Bytes()
+		end := append(append([]byte{}, cdcDir.Bytes()...), before...)
+		for _, kv := range tr.GetRange(begin, end) {
+			tr.Clear(kv.Key)
+		}
+		return
+	})
+	return
+}
@@ -0,0 +1,65 @@
+package opentick
+
+import (
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+func TestEnableCDC(t *testing.T) {
+	s := NewMemStorage()
+	if err := CreateDatabase(s, "db1"); err != nil {
+		t.Fatalf("CreateDatabase: %v", err)
+	}
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	createTestTable(t, s, "db1", "t1", tbl)
+
+	if err := EnableCDC(s, "db1", "t1", true); err != nil {
+		t.Fatalf("EnableCDC(true): %v", err)
+	}
+	if exists, err := s.ExistsDir(cdcDirPath("db1", "t1")); err != nil || !exists {
+		t.Fatalf("cdc directory after enable: exists=%v err=%v", exists, err)
+	}
+	got, err := GetTableScheme(s, "db1", "t1")
+	if err != nil {
+		t.Fatalf("GetTableScheme: %v", err)
+	}
+	if !got.CDCEnabled {
+		t.Fatal("CDCEnabled not set after EnableCDC(true)")
+	}
+
+	if err := EnableCDC(s, "db1", "t1", false); err != nil {
+		t.Fatalf("EnableCDC(false): %v", err)
+	}
+	got, err = GetTableScheme(s, "db1", "t1")
+	if err != nil {
+		t.Fatalf("GetTableScheme: %v", err)
+	}
+	if got.CDCEnabled {
+		t.Fatal("CDCEnabled still set after EnableCDC(false)")
+	}
+}
+
+// TestDecodeCDCEvent exercises the pure decode side of the chunk0-4 CDC
+// path: the op/key/value tuple WriteCDCEvent packs must come back out the
+// same shape, independent of the versionstamped-key machinery that needs a
+// real FoundationDB transaction to exercise.
+func TestDecodeCDCEvent(t *testing.T) {
+	key := []interface{}{int64(1)}
+	value := []interface{}{"a"}
+	packed := tuple.Tuple{int(CDCUpdate), tuple.Tuple(key), tuple.Tuple(value)}.Pack()
+	versionstamp := make([]byte, 10)
+	kv := KeyValue{Key: append([]byte("prefix"), versionstamp...), Value: packed}
+
+	ev := decodeCDCEvent(kv)
+	if ev.Op != CDCUpdate {
+		t.Fatalf("Op = %v, want CDCUpdate", ev.Op)
+	}
+	if len(ev.Key) != 1 || ev.Key[0] != int64(1) {
+		t.Fatalf("Key = %v, want [1]", ev.Key)
+	}
+	if len(ev.Value) != 1 || ev.Value[0] != "a" {
+		t.Fatalf("Value = %v, want [a]", ev.Value)
+	}
+}
@@ -0,0 +1,211 @@
+package opentick
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// AstCreateIndex represents a parsed `CREATE INDEX name ON db.table (cols...)`
+// statement.
+type AstCreateIndex struct {
+	IndexName string
+	Name      *AstTableName
+	Cols      []string
+}
+
+// AstDropIndex represents a parsed `DROP INDEX name ON db.table` statement.
+type AstDropIndex struct {
+	IndexName string
+	Name      *AstTableName
+}
+
+// IndexDef describes one secondary index: the ordered columns it is keyed
+// on, and the directory its entries live under.
+type IndexDef struct {
+	Name string
+	Cols []*TableColDef
+	Dir  Dir
+}
+
+// encode persists an index's name and the PosCol of each column it's keyed
+// on; its Dir is reopened from storage when the owning scheme is loaded,
+// the same way TableScheme.Dir is never part of the encoded scheme blob.
+func (self *IndexDef) encode() []byte {
+	var out []byte
+	bn := make([]byte, 4)
+	binary.BigEndian.PutUint32(bn, uint32(len(self.Name)))
+	out = append(bn, []byte(self.Name)...)
+	binary.BigEndian.PutUint32(bn, uint32(len(self.Cols)))
+	out = append(out, bn...)
+	for _, col := range self.Cols {
+		binary.BigEndian.PutUint32(bn, col.PosCol)
+		out = append(out, bn...)
+	}
+	return out
+}
+
+func decodeIndexDef(bytes []byte, out *IndexDef, cols []TableColDef) []byte {
+	n := binary.BigEndian.Uint32(bytes)
+	bytes = bytes[4:]
+	out.Name = string(bytes[:n])
+	bytes = bytes[n:]
+	n = binary.BigEndian.Uint32(bytes)
+	bytes = bytes[4:]
+	out.Cols = make([]*TableColDef, n)
+	for i := uint32(0); i < n; i++ {
+		out.Cols[i] = &cols[int(binary.BigEndian.Uint32(bytes))]
+		bytes = bytes[4:]
+	}
+	return bytes
+}
+
+func (self *TableScheme) findIndex(name string) int {
+	for i, idx := range self.Indexes {
+		if idx.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// CreateIndex adds a secondary index to an existing table so WHERE clauses
+// on its leading columns don't require a full table scan. Index entries are
+// maintained by the insert/delete transaction path (see row.go's
+// InsertRow/DeleteRow), which
+// writes/clears a key of indexDir.Pack(indexColValues..., primaryKeyValues...)
+// with an empty value for every row it mutates.
+func CreateIndex(s Storage, dbName string, ast *AstCreateIndex) (err error) {
+	if dbName == "" {
+		dbName = ast.Name.DatabaseName()
+	}
+	tblName := ast.Name.TableName()
+	_, dirScheme, err1 := openTable(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		tbl := decodeTableScheme(tr.Get(dirScheme.Bytes()))
+		if tbl.findIndex(ast.IndexName) >= 0 {
+			err = errors.New("Index " + ast.IndexName + " already exists")
+			return
+		}
+		cols := make([]*TableColDef, len(ast.Cols))
+		for i, name := range ast.Cols {
+			col, ok := tbl.NameMap[name]
+			if !ok {
+				err = errors.New("Unknown definition " + name + " referenced in index " + ast.IndexName)
+				return
+			}
+			cols[i] = col
+		}
+		indexDir, err2 := tr.CreateDir([]string{"db", dbName, tblName, "index", ast.IndexName})
+		if err2 != nil {
+			err = err2
+			return
+		}
+		tbl.Indexes = append(tbl.Indexes, IndexDef{Name: ast.IndexName, Cols: cols, Dir: indexDir})
+		tr.Set(dirScheme.Bytes(), tbl.encode())
+		return
+	})
+	if err == nil {
+		s.SchemeCache().Delete(dbName + "." + tblName)
+	}
+	return
+}
+
+// DropIndex removes a secondary index and all of its entries.
+func DropIndex(s Storage, dbName string, ast *AstDropIndex) (err error) {
+	if dbName == "" {
+		dbName = ast.Name.DatabaseName()
+	}
+	tblName := ast.Name.TableName()
+	_, dirScheme, err1 := openTable(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		tbl := decodeTableScheme(tr.Get(dirScheme.Bytes()))
+		i := tbl.findIndex(ast.IndexName)
+		if i < 0 {
+			err = errors.New("Index " + ast.IndexName + " does not exist")
+			return
+		}
+		tbl.Indexes = append(tbl.Indexes[:i], tbl.Indexes[i+1:]...)
+		tr.Set(dirScheme.Bytes(), tbl.encode())
+		return
+	})
+	if err != nil {
+		return
+	}
+	_, err = s.RemoveDir([]string{"db", dbName, tblName, "index", ast.IndexName})
+	if err == nil {
+		s.SchemeCache().Delete(dbName + "." + tblName)
+	}
+	return
+}
+
+// packIndexKey builds the key an index entry for a row is stored under:
+// the index's own directory prefix, followed by its indexed column values
+// in order, followed by the row's full primary key, so entries for distinct
+// rows never collide even when the indexed columns are not unique.
+func packIndexKey(idx *IndexDef, indexColValues []interface{}, primaryKeyValues []interface{}) []byte {
+	t := make(tuple.Tuple, 0, len(indexColValues)+len(primaryKeyValues))
+	for _, v := range indexColValues {
+		t = append(t, v)
+	}
+	for _, v := range primaryKeyValues {
+		t = append(t, v)
+	}
+	return append(append([]byte{}, idx.Dir.Bytes()...), t.Pack()...)
+}
+
+// UpdateIndexes keeps every index on tbl consistent with one row's change.
+// It must run inside the same transaction as the row write/delete itself:
+// oldValues is nil on insert, newValues is nil on delete, and both are
+// given for an update that changes an indexed column's value.
+func UpdateIndexes(tr Txn, tbl *TableScheme, primaryKeyValues []interface{}, oldValues map[string]interface{}, newValues map[string]interface{}) {
+	for i := range tbl.Indexes {
+		idx := &tbl.Indexes[i]
+		if oldValues != nil {
+			old := make([]interface{}, len(idx.Cols))
+			for j, col := range idx.Cols {
+				old[j] = oldValues[col.Name]
+			}
+			tr.Clear(packIndexKey(idx, old, primaryKeyValues))
+		}
+		if newValues != nil {
+			next := make([]interface{}, len(idx.Cols))
+			for j, col := range idx.Cols {
+				next[j] = newValues[col.Name]
+			}
+			tr.Set(packIndexKey(idx, next, primaryKeyValues), []byte{})
+		}
+	}
+}
+
+// IndexForColumns returns the index on tbl whose leading columns exactly
+// match cols, if any, so the query planner can prefer an index prefix scan
+// over a full table scan for a WHERE clause on those columns.
+func (self *TableScheme) IndexForColumns(cols []string) *IndexDef {
+	for i := range self.Indexes {
+		idx := &self.Indexes[i]
+		if len(idx.Cols) < len(cols) {
+			continue
+		}
+		match := true
+		for j, name := range cols {
+			if idx.Cols[j].Name != name {
+				match = false
+				break
+			}
+		}
+		if match {
+			return idx
+		}
+	}
+	return nil
+}
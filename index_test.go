@@ -0,0 +1,147 @@
+package opentick
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+func TestFindIndex(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	tbl.Indexes = []IndexDef{{Name: "by_val", Cols: []*TableColDef{tbl.NameMap["val"]}}}
+	if i := tbl.findIndex("by_val"); i != 0 {
+		t.Fatalf("findIndex(by_val) = %d, want 0", i)
+	}
+	if i := tbl.findIndex("nope"); i != -1 {
+		t.Fatalf("findIndex(nope) = %d, want -1", i)
+	}
+}
+
+func TestIndexForColumns(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("a", Text), NewTableColDef("b", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	tbl.Indexes = []IndexDef{
+		{Name: "by_a_b", Cols: []*TableColDef{tbl.NameMap["a"], tbl.NameMap["b"]}},
+	}
+	if idx := tbl.IndexForColumns([]string{"a"}); idx == nil || idx.Name != "by_a_b" {
+		t.Fatalf("IndexForColumns([a]) = %v, want by_a_b (prefix match)", idx)
+	}
+	if idx := tbl.IndexForColumns([]string{"a", "b"}); idx == nil || idx.Name != "by_a_b" {
+		t.Fatalf("IndexForColumns([a,b]) = %v, want by_a_b", idx)
+	}
+	if idx := tbl.IndexForColumns([]string{"b"}); idx != nil {
+		t.Fatalf("IndexForColumns([b]) = %v, want nil (b is not a leading column)", idx)
+	}
+	if idx := tbl.IndexForColumns([]string{"a", "b", "id"}); idx != nil {
+		t.Fatalf("IndexForColumns([a,b,id]) = %v, want nil (more columns than the index has)", idx)
+	}
+}
+
+// TestIndexDefEncodeDecodeRoundTrip exercises the PosCol-based encoding
+// IndexDef.encode/decodeIndexDef share with the rest of the scheme: an
+// index's columns are persisted as PosCol indices into the table's Cols
+// slice, which only stays valid across a DROP COLUMN because dropColumn
+// tombstones in place instead of shifting positions (see alter_test.go).
+func TestIndexDefEncodeDecodeRoundTrip(t *testing.T) {
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("a", Text), NewTableColDef("b", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	idx := IndexDef{Name: "by_b", Cols: []*TableColDef{tbl.NameMap["b"]}}
+
+	encoded := idx.encode()
+	var decoded IndexDef
+	rest := decodeIndexDef(encoded, &decoded, tbl.Cols)
+	if len(rest) != 0 {
+		t.Fatalf("decodeIndexDef left %d trailing bytes", len(rest))
+	}
+	if decoded.Name != "by_b" {
+		t.Fatalf("decoded Name = %q, want by_b", decoded.Name)
+	}
+	if len(decoded.Cols) != 1 || decoded.Cols[0].Name != "b" {
+		t.Fatalf("decoded Cols = %+v, want [b]", decoded.Cols)
+	}
+}
+
+func TestPackIndexKeyOrdersIndexColsBeforePrimaryKey(t *testing.T) {
+	dir, err := NewMemStorage().CreateDir([]string{"db", "db1", "t1", "index", "by_val"})
+	if err != nil {
+		t.Fatalf("CreateDir: %v", err)
+	}
+	idx := &IndexDef{Name: "by_val", Dir: dir}
+	key := packIndexKey(idx, []interface{}{"a"}, []interface{}{int64(1)})
+	if len(key) <= len(dir.Bytes()) {
+		t.Fatalf("packIndexKey did not extend past the index directory prefix")
+	}
+	want := append(append([]byte{}, dir.Bytes()...), tuple.Tuple{"a", int64(1)}.Pack()...)
+	if !bytes.Equal(key, want) {
+		t.Fatalf("packIndexKey = %q, want index column values before primary key %q", key, want)
+	}
+}
+
+// TestUpdateIndexesInsertUpdateDelete exercises UpdateIndexes directly
+// against a Txn, covering the insert (oldValues nil), update (both sides
+// set, indexed column value changes), and delete (newValues nil) cases row.go
+// relies on it for.
+func TestUpdateIndexesInsertUpdateDelete(t *testing.T) {
+	s := NewMemStorage()
+	indexDir, err := s.CreateDir([]string{"db", "db1", "t1", "index", "by_val"})
+	if err != nil {
+		t.Fatalf("CreateDir: %v", err)
+	}
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	tbl.Indexes = []IndexDef{{Name: "by_val", Cols: []*TableColDef{tbl.NameMap["val"]}, Dir: indexDir}}
+
+	keyVals := []interface{}{int64(1)}
+	oldKey := packIndexKey(&tbl.Indexes[0], []interface{}{"a"}, keyVals)
+	newKey := packIndexKey(&tbl.Indexes[0], []interface{}{"b"}, keyVals)
+
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		UpdateIndexes(tr, &tbl, keyVals, nil, map[string]interface{}{"val": "a"})
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact insert: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if tr.Get(oldKey) == nil {
+			t.Fatal("index entry not written on insert")
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		UpdateIndexes(tr, &tbl, keyVals, map[string]interface{}{"val": "a"}, map[string]interface{}{"val": "b"})
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact update: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if tr.Get(oldKey) != nil {
+			t.Fatal("old index entry still present after update")
+		}
+		if tr.Get(newKey) == nil {
+			t.Fatal("new index entry not written by update")
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		UpdateIndexes(tr, &tbl, keyVals, map[string]interface{}{"val": "b"}, nil)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact delete: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if tr.Get(newKey) != nil {
+			t.Fatal("index entry still present after delete")
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package opentick
+
+import (
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// IterOptions controls a RowIterator the same way LevelDB/tmlibs iterators
+// are configured: direction and an optional row cap. BatchSize is accepted
+// (and defaulted to defaultIterBatchSize) but not used: rows are fetched with
+// fdb.StreamingModeIterator, which picks its own batch sizes.
+type IterOptions struct {
+	Reverse   bool
+	Limit     int
+	BatchSize int
+}
+
+const defaultIterBatchSize = 1000
+
+// transactionTooOld is the FDB error code returned when a transaction has
+// been open longer than the 5 second limit; a RowIterator recovers from it
+// by opening a fresh snapshot read starting just after the last key it
+// delivered.
+const transactionTooOld = 1007
+
+// RowIterator lazily decodes rows out of a table's key range, one GetRange
+// batch at a time, without requiring the caller to hand-roll range logic or
+// worry about FDB's per-transaction time limit.
+type RowIterator struct {
+	scheme *TableScheme
+	db     fdb.Transactor
+	tr     fdb.ReadTransaction
+	iter   *fdb.RangeIterator
+	opts   IterOptions
+	begin  fdb.Key
+	end    fdb.Key
+
+	key   []interface{}
+	value []interface{}
+	err   error
+	done  bool
+
+	// delivered counts rows handed back via decode across every restart, so
+	// a restart can ask for only opts.Limit-delivered more instead of
+	// re-requesting the original limit and yielding more rows than asked.
+	delivered int
+}
+
+func packRowBound(dir Dir, vals []interface{}) fdb.Key {
+	t := make(tuple.Tuple, len(vals))
+	for i, v := range vals {
+		t[i] = v
+	}
+	return fdb.Key(append(append([]byte{}, dir.Bytes()...), t.Pack()...))
+}
+
+// NewIterator opens a RowIterator over [start, end) of self's row data,
+// reading through tr. start/end are prefixes of the primary key, in key
+// column order; pass nil for either to scan from/to the edge of the table.
+//
+// db, if non-nil, is used to open a fresh transaction and resume scanning
+// when tr runs past FDB's 5 second transaction limit. It must be a real
+// fdb.Database (or anything else whose Transact genuinely opens a new
+// transaction) rather than tr itself cast to fdb.Transactor: fdb.Transaction
+// also satisfies fdb.Transactor, but its Transact just replays the callback
+// against the same, already-expired transaction, so inferring a restart
+// handle from tr would silently make the restart a no-op for the common
+// case of an iterator opened from inside someone else's db.Transact. Pass
+// nil to disable restart and surface transactionTooOld as a normal Err().
+func (self *TableScheme) NewIterator(tr fdb.ReadTransaction, db fdb.Transactor, start []interface{}, end []interface{}, opts IterOptions) *RowIterator {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultIterBatchSize
+	}
+	it := &RowIterator{scheme: self, tr: tr, db: db, opts: opts}
+	it.begin = packRowBound(self.Dir, start)
+	if end == nil {
+		it.end = fdb.Key(append(append([]byte{}, self.Dir.Bytes()...), 0xFF))
+	} else {
+		it.end = packRowBound(self.Dir, end)
+	}
+	it.openRange(it.begin, it.end)
+	return it
+}
+
+func (self *RowIterator) openRange(begin, end fdb.Key) {
+	limit := self.opts.Limit
+	if limit > 0 {
+		limit -= self.delivered
+	}
+	kr := fdb.KeyRange{Begin: begin, End: end}
+	ro := fdb.RangeOptions{
+		Limit:   limit,
+		Reverse: self.opts.Reverse,
+		Mode:    fdb.StreamingModeIterator,
+	}
+	self.iter = self.tr.GetRange(kr, ro).Iterator()
+}
+
+func isTransactionTooOld(err error) bool {
+	fe, ok := err.(fdb.Error)
+	return ok && fe.Code == transactionTooOld
+}
+
+// Next advances the iterator and reports whether a row is available via
+// Key/Value. If the underlying transaction has run past FDB's 5 second
+// limit and NewIterator was given a restart-capable db, it transparently
+// opens a new transaction's range read starting right after the last key
+// it delivered and keeps going, asking for only what's left of opts.Limit.
+func (self *RowIterator) Next() bool {
+	if self.done || self.err != nil {
+		return false
+	}
+	if !self.iter.Advance() {
+		self.done = true
+		return false
+	}
+	kv, err := self.iter.Get()
+	if err != nil {
+		if self.db != nil && isTransactionTooOld(err) && self.key != nil {
+			self.restartAfter(self.scheme.rowKey(self.key))
+			return self.Next()
+		}
+		self.err = err
+		self.done = true
+		return false
+	}
+	self.decode(kv)
+	return true
+}
+
+// restartAfter reopens the range to cover whatever this iterator hasn't
+// delivered yet, starting just past lastKey. Which bound moves depends on
+// scan direction: a forward scan has already consumed everything up to and
+// including lastKey, so Begin advances past it; a reverse scan has already
+// consumed everything from lastKey on down to self.end, so it's End that
+// shrinks to lastKey (exclusive) instead - re-using the old Begin/End as
+// the moving bound regardless of direction would re-scan the already
+// delivered range rather than progress toward the rest of it.
+func (self *RowIterator) restartAfter(lastKey fdb.Key) {
+	_, err := self.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		self.tr = tr
+		if self.opts.Reverse {
+			self.openRange(self.begin, lastKey)
+		} else {
+			self.openRange(append(append(fdb.Key{}, lastKey...), 0x00), self.end)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		self.err = err
+		self.done = true
+	}
+}
+
+func (self *TableScheme) rowKey(keyVals []interface{}) fdb.Key {
+	return packRowBound(self.Dir, keyVals)
+}
+
+func (self *RowIterator) decode(kv fdb.KeyValue) {
+	keyBytes := []byte(kv.Key)[len(self.scheme.Dir.Bytes()):]
+	keyTuple, err := tuple.Unpack(keyBytes)
+	if err != nil {
+		self.err = err
+		self.done = true
+		return
+	}
+	valTuple, err := tuple.Unpack(kv.Value)
+	if err != nil {
+		self.err = err
+		self.done = true
+		return
+	}
+	row := make([]interface{}, len(self.scheme.Cols))
+	for _, col := range self.scheme.Key {
+		row[col.PosCol] = keyTuple[col.Pos]
+	}
+	for _, col := range self.scheme.Value {
+		// A column added by an ALTER TABLE (see TableColDef.AddedVersion)
+		// after this row was written has no element in valTuple at all.
+		// Pos is never reused once assigned (see TableScheme.fill), so this
+		// bounds check is reliable even for a table that's since had a
+		// DROP COLUMN.
+		if int(col.Pos) < len(valTuple) {
+			row[col.PosCol] = valTuple[col.Pos]
+		} else {
+			row[col.PosCol] = zeroValueForType(col.Type)
+		}
+	}
+	self.key = []interface{}(keyTuple)
+	self.value = row
+	self.delivered++
+}
+
+// Key returns the primary key columns of the current row, in key column
+// order. Valid only after a call to Next returns true.
+func (self *RowIterator) Key() []interface{} {
+	return self.key
+}
+
+// Value returns every column of the current row, in TableScheme.Cols
+// order. Valid only after a call to Next returns true.
+func (self *RowIterator) Value() []interface{} {
+	return self.value
+}
+
+// Valid reports whether the iterator is still positioned on a row.
+func (self *RowIterator) Valid() bool {
+	return !self.done && self.err == nil
+}
+
+// Err returns the first error encountered while iterating, if any.
+func (self *RowIterator) Err() error {
+	return self.err
+}
+
+// Close releases the iterator. It does not close the underlying
+// transaction, which remains owned by whoever created it.
+func (self *RowIterator) Close() {
+	self.done = true
+}
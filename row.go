@@ -0,0 +1,158 @@
+package opentick
+
+import (
+	"errors"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// encodeRow packs one row's key and value columns into the tuple-encoded
+// key/value pair RowIterator reads back, returning the primary key values
+// separately since index maintenance needs them on their own.
+func encodeRow(tbl *TableScheme, values map[string]interface{}) (keyVals []interface{}, key []byte, value []byte, err error) {
+	keyVals = make([]interface{}, len(tbl.Key))
+	for i, col := range tbl.Key {
+		v, ok := values[col.Name]
+		if !ok {
+			err = errors.New("Missing value for key column " + col.Name)
+			return
+		}
+		keyVals[i] = v
+	}
+	// Sized to valueSlots, not len(tbl.Value): a dropped column still holds
+	// its old Pos, and every write after the drop must leave that slot as a
+	// null element so later columns' Pos still land at the right index (see
+	// TableScheme.fill).
+	valTuple := make(tuple.Tuple, tbl.valueSlots)
+	for _, col := range tbl.Value {
+		valTuple[col.Pos] = values[col.Name]
+	}
+	key = packRowKey(tbl, keyVals)
+	value = valTuple.Pack()
+	return
+}
+
+// valuesOf orders a name->value map into tbl.Value order, the same order
+// RowEvent.Value and RowIterator.Value use for a row's non-key columns.
+func valuesOf(tbl *TableScheme, values map[string]interface{}) []interface{} {
+	out := make([]interface{}, len(tbl.Value))
+	for i, col := range tbl.Value {
+		out[i] = values[col.Name]
+	}
+	return out
+}
+
+func packRowKey(tbl *TableScheme, keyVals []interface{}) []byte {
+	t := make(tuple.Tuple, len(keyVals))
+	for i, v := range keyVals {
+		t[i] = v
+	}
+	return append(append([]byte{}, tbl.Dir.Bytes()...), t.Pack()...)
+}
+
+// decodeRowValues unpacks a row's value bytes into name->value, defaulting
+// a column to its zero value instead of panicking on a short tuple when its
+// Pos falls outside the tuple: a column added by an ALTER TABLE (see
+// TableColDef.AddedVersion) after the row was written has no element for
+// it at all, since valueSlots was smaller at the time. Pos itself is never
+// reused once assigned, so this bounds check alone is enough even across a
+// DROP COLUMN - see TableScheme.fill.
+func decodeRowValues(tbl *TableScheme, raw []byte) map[string]interface{} {
+	valTuple, err := tuple.Unpack(raw)
+	if err != nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(tbl.Value))
+	for _, col := range tbl.Value {
+		if int(col.Pos) < len(valTuple) {
+			out[col.Name] = valTuple[col.Pos]
+		} else {
+			out[col.Name] = zeroValueForType(col.Type)
+		}
+	}
+	return out
+}
+
+// InsertRow writes one row into dbName.tblName, maintaining every
+// secondary index in tbl.Indexes and, if CDC is enabled on the table and s
+// is a FoundationDB Storage (see fdbTxnOf), recording the mutation for
+// Subscribe within the same transaction so an index or CDC event can never
+// be observed out of sync with the row it was derived from. Overwriting an
+// existing row clears its old index entries and is recorded as a CDCUpdate.
+// This is the insert path CreateIndex's and WriteCDCEvent's doc comments
+// refer to.
+func InsertRow(s Storage, dbName, tblName string, values map[string]interface{}) (err error) {
+	tbl, err1 := GetTableScheme(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	keyVals, key, value, err2 := encodeRow(&tbl, values)
+	if err2 != nil {
+		err = err2
+		return
+	}
+	var cdcDir Dir
+	if tbl.CDCEnabled {
+		if cdcDir, err = s.OpenDir(cdcDirPath(dbName, tblName)); err != nil {
+			return
+		}
+	}
+	_, err = s.Transact(func(tr Txn) (interface{}, error) {
+		var oldValues map[string]interface{}
+		op := CDCInsert
+		if raw := tr.Get(key); raw != nil {
+			oldValues = decodeRowValues(&tbl, raw)
+			op = CDCUpdate
+		}
+		tr.Set(key, value)
+		UpdateIndexes(tr, &tbl, keyVals, oldValues, values)
+		if cdcDir != nil {
+			if ftr, ok := fdbTxnOf(tr); ok {
+				WriteCDCEvent(ftr, cdcDir, op, keyVals, valuesOf(&tbl, values))
+			}
+		}
+		return nil, nil
+	})
+	return
+}
+
+// DeleteRow removes one row from dbName.tblName by its primary key,
+// clearing every secondary index entry derived from it and, if CDC is
+// enabled and s is a FoundationDB Storage, recording the deletion for
+// Subscribe, all within the same
+// transaction. Deleting a key that doesn't exist is not an error.
+func DeleteRow(s Storage, dbName, tblName string, keyVals []interface{}) (err error) {
+	tbl, err1 := GetTableScheme(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if len(keyVals) != len(tbl.Key) {
+		err = errors.New("Wrong number of primary key values")
+		return
+	}
+	var cdcDir Dir
+	if tbl.CDCEnabled {
+		if cdcDir, err = s.OpenDir(cdcDirPath(dbName, tblName)); err != nil {
+			return
+		}
+	}
+	key := packRowKey(&tbl, keyVals)
+	_, err = s.Transact(func(tr Txn) (interface{}, error) {
+		raw := tr.Get(key)
+		if raw == nil {
+			return nil, nil
+		}
+		oldValues := decodeRowValues(&tbl, raw)
+		tr.Clear(key)
+		UpdateIndexes(tr, &tbl, keyVals, oldValues, nil)
+		if cdcDir != nil {
+			if ftr, ok := fdbTxnOf(tr); ok {
+				WriteCDCEvent(ftr, cdcDir, CDCDelete, keyVals, valuesOf(&tbl, oldValues))
+			}
+		}
+		return nil, nil
+	})
+	return
+}
@@ -0,0 +1,149 @@
+package opentick
+
+import "testing"
+
+func TestInsertDeleteRow(t *testing.T) {
+	s := NewMemStorage()
+	if err := CreateDatabase(s, "db1"); err != nil {
+		t.Fatalf("CreateDatabase: %v", err)
+	}
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	createTestTable(t, s, "db1", "t1", tbl)
+
+	if err := InsertRow(s, "db1", "t1", map[string]interface{}{"id": int64(1), "val": "a"}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+	got, err := GetTableScheme(s, "db1", "t1")
+	if err != nil {
+		t.Fatalf("GetTableScheme: %v", err)
+	}
+	key := packRowKey(&got, []interface{}{int64(1)})
+	var raw []byte
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		raw = tr.Get(key)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if raw == nil {
+		t.Fatal("row not found after InsertRow")
+	}
+	values := decodeRowValues(&got, raw)
+	if values["val"] != "a" {
+		t.Fatalf("val = %v, want %q", values["val"], "a")
+	}
+
+	if err := DeleteRow(s, "db1", "t1", []interface{}{int64(1)}); err != nil {
+		t.Fatalf("DeleteRow: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		raw = tr.Get(key)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if raw != nil {
+		t.Fatal("row still present after DeleteRow")
+	}
+
+	// Deleting an already-absent key is not an error.
+	if err := DeleteRow(s, "db1", "t1", []interface{}{int64(1)}); err != nil {
+		t.Fatalf("DeleteRow of absent key: %v", err)
+	}
+}
+
+// TestInsertRowMaintainsIndex exercises the chunk0-3 fix: InsertRow/DeleteRow
+// must keep every secondary index on the table in sync within the same
+// transaction as the row write/delete.
+func TestInsertRowMaintainsIndex(t *testing.T) {
+	s := NewMemStorage()
+	if err := CreateDatabase(s, "db1"); err != nil {
+		t.Fatalf("CreateDatabase: %v", err)
+	}
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	createTestTable(t, s, "db1", "t1", tbl)
+
+	indexDir, err := s.CreateDir([]string{"db", "db1", "t1", "index", "by_val"})
+	if err != nil {
+		t.Fatalf("CreateDir for index: %v", err)
+	}
+	tbl2, err := GetTableScheme(s, "db1", "t1")
+	if err != nil {
+		t.Fatalf("GetTableScheme: %v", err)
+	}
+	idx := IndexDef{Name: "by_val", Cols: []*TableColDef{tbl2.NameMap["val"]}, Dir: indexDir}
+	tbl2.Indexes = append(tbl2.Indexes, idx)
+	_, dirScheme, err := openTable(s, "db1", "t1")
+	if err != nil {
+		t.Fatalf("openTable: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		tr.Set(dirScheme.Bytes(), tbl2.encode())
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("persist scheme with index: %v", err)
+	}
+	s.SchemeCache().Delete("db1.t1")
+
+	if err := InsertRow(s, "db1", "t1", map[string]interface{}{"id": int64(1), "val": "a"}); err != nil {
+		t.Fatalf("InsertRow: %v", err)
+	}
+	tbl3, err := GetTableScheme(s, "db1", "t1")
+	if err != nil {
+		t.Fatalf("GetTableScheme: %v", err)
+	}
+	indexKey := packIndexKey(&tbl3.Indexes[0], []interface{}{"a"}, []interface{}{int64(1)})
+	var raw []byte
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		raw = tr.Get(indexKey)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if raw == nil {
+		t.Fatal("index entry not written by InsertRow")
+	}
+
+	if err := DeleteRow(s, "db1", "t1", []interface{}{int64(1)}); err != nil {
+		t.Fatalf("DeleteRow: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		raw = tr.Get(indexKey)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if raw != nil {
+		t.Fatal("index entry still present after DeleteRow")
+	}
+}
+
+// TestDecodeRowValuesDefaultsShortTuple exercises the chunk0-6 fix: a row
+// written before a later ALTER TABLE ADD COLUMN has no encoded element for
+// the new column, and must default to its zero value instead of panicking.
+func TestDecodeRowValuesDefaultsShortTuple(t *testing.T) {
+	// Row written against the original two-column scheme.
+	oldCols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	oldTbl := NewTableScheme(oldCols, []int{0})
+	_, _, value, err := encodeRow(&oldTbl, map[string]interface{}{"id": int64(1), "val": "a"})
+	if err != nil {
+		t.Fatalf("encodeRow: %v", err)
+	}
+
+	// Same table after an ALTER TABLE ADD COLUMN: the current scheme has a
+	// third column the old row's encoded value tuple has no element for.
+	extra := NewTableColDef("extra", BigInt)
+	extra.AddedVersion = schemeVersion
+	newCols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text), extra}
+	newTbl := NewTableScheme(newCols, []int{0})
+
+	values := decodeRowValues(&newTbl, value)
+	if values["val"] != "a" {
+		t.Fatalf("val = %v, want %q", values["val"], "a")
+	}
+	if values["extra"] != int64(0) {
+		t.Fatalf("extra = %v, want 0 (zero value default)", values["extra"])
+	}
+}
@@ -3,16 +3,13 @@ package opentick
 import (
 	"encoding/binary"
 	"errors"
-	"github.com/apple/foundationdb/bindings/go/src/fdb"
-	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"strings"
-	"sync"
+	"time"
 )
 
 type DataType uint32
 
 var FdbVersion = 520
-var TableSchemeMap = sync.Map{}
 
 const (
 	UnknowDataType DataType = iota
@@ -27,9 +24,27 @@ const (
 	Text
 )
 
-func CreateDatabase(db fdb.Transactor, dbName string) (err error) {
+// zeroValueForType is what a column reads as when a row was written before
+// that column existed (see TableColDef.AddedVersion): the row's encoded
+// value tuple simply has no element for it, so callers that walk past the
+// end of the tuple default to this instead of indexing out of range.
+func zeroValueForType(t DataType) interface{} {
+	switch t {
+	case TinyInt, SmallInt, Int, BigInt, Timestamp:
+		return int64(0)
+	case Double, Float:
+		return float64(0)
+	case Boolean:
+		return false
+	case Text:
+		return ""
+	}
+	return nil
+}
+
+func CreateDatabase(s Storage, dbName string) (err error) {
 	path := []string{"db", dbName}
-	exists, err1 := directory.Exists(db, path)
+	exists, err1 := s.ExistsDir(path)
 	if err1 != nil {
 		err = err1
 		return
@@ -38,32 +53,28 @@ func CreateDatabase(db fdb.Transactor, dbName string) (err error) {
 		err = errors.New("Database " + dbName + " already exists")
 		return
 	}
-	_, err2 := directory.Create(db, path, nil)
-	if err2 != nil {
-		err = err2
-		return
-	}
+	_, err = s.CreateDir(path)
 	return
 }
 
-func ListTables(db fdb.Transactor, dbName string) (tables []string, err error) {
+func ListTables(s Storage, dbName string) (tables []string, err error) {
 	path := []string{"db", dbName}
-	dir, err1 := directory.Open(db, path, nil)
+	exists, err1 := s.ExistsDir(path)
 	if err1 != nil {
 		err = err1
 		return
 	}
-	if dir == nil {
+	if !exists {
 		err = errors.New("Database " + dbName + " does not exist")
 		return
 	}
-	tables, err = dir.List(db, nil)
+	tables, err = s.ListDir(path)
 	return
 }
 
-func DropDatabase(db fdb.Transactor, dbName string) (err error) {
+func DropDatabase(s Storage, dbName string) (err error) {
 	path := []string{"db", dbName}
-	exists, err1 := directory.Exists(db, path)
+	exists, err1 := s.ExistsDir(path)
 	if err1 != nil {
 		err = err1
 		return
@@ -72,18 +83,18 @@ func DropDatabase(db fdb.Transactor, dbName string) (err error) {
 		err = errors.New("Database " + dbName + " does not exist")
 		return
 	}
-	tables, err2 := ListTables(db, dbName)
+	tables, err2 := ListTables(s, dbName)
 	if err2 != nil {
 		err = err2
 		return
 	}
 	for _, tbl := range tables {
-		err = DropTable(db, dbName, tbl)
+		err = DropTable(s, dbName, tbl)
 		if err != nil {
 			return
 		}
 	}
-	_, err = directory.Root().Remove(db, path)
+	_, err = s.RemoveDir(path)
 	return
 }
 
@@ -98,15 +109,32 @@ type TableColDef struct {
 	IsKey  bool
 	PosCol uint32
 	Pos    uint32 // position in Key or Value
+
+	// AddedVersion is the schemeVersion this column was added in. Rows
+	// written before that version never encoded a value for it, so readers
+	// must default it to its zero value rather than expecting one on disk.
+	AddedVersion uint32
+
+	// Dropped marks a value column removed by ALTER TABLE DROP COLUMN. The
+	// column is kept in TableScheme.Cols, with its Pos untouched, instead of
+	// being cut out: reusing a dropped column's Pos for whatever column used
+	// to come after it would make every row written before the drop decode
+	// with the wrong bytes for that later column. A dropped column is
+	// excluded from TableScheme.Value and NameMap, so it's no longer written
+	// or resolvable by name, and its old Pos slot in the value tuple is left
+	// as a null element on every future write (see TableScheme.fill and
+	// encodeRow).
+	Dropped bool
 }
 
 func NewTableColDef(name string, t DataType) (tbl TableColDef) {
 	tbl.Name = name
 	tbl.Type = t
+	tbl.AddedVersion = 1
 	return
 }
 
-const schemeVersion uint32 = 1
+const schemeVersion uint32 = 6
 
 func (self *TableColDef) encode() []byte {
 	var out []byte
@@ -114,7 +142,13 @@ func (self *TableColDef) encode() []byte {
 	binary.BigEndian.PutUint32(bn, uint32(len(self.Name)))
 	out = append(bn, []byte(self.Name)...)
 	binary.BigEndian.PutUint32(bn, uint32(self.Type))
-	return append(out, bn...)
+	out = append(out, bn...)
+	binary.BigEndian.PutUint32(bn, self.AddedVersion)
+	out = append(out, bn...)
+	if self.Dropped {
+		return append(out, 1)
+	}
+	return append(out, 0)
 }
 
 func decodeTableColDef(bytes []byte, out *TableColDef, version uint32) []byte {
@@ -123,7 +157,25 @@ func decodeTableColDef(bytes []byte, out *TableColDef, version uint32) []byte {
 	out.Name = string(bytes[:n])
 	bytes = bytes[n:]
 	out.Type = DataType(binary.BigEndian.Uint32(bytes))
-	return bytes[4:]
+	bytes = bytes[4:]
+	if version < 2 {
+		// Schemes written before ALTER TABLE existed predate the
+		// AddedVersion tag; every column on them was present from the
+		// start.
+		out.AddedVersion = 1
+		return bytes
+	}
+	out.AddedVersion = binary.BigEndian.Uint32(bytes)
+	bytes = bytes[4:]
+	if version < 6 {
+		// Schemes written before DROP COLUMN tombstoned columns instead of
+		// cutting them out predate the Dropped tag; nothing on them was
+		// ever dropped in place.
+		out.Dropped = false
+		return bytes
+	}
+	out.Dropped = bytes[0] != 0
+	return bytes[1:]
 }
 
 type TableScheme struct {
@@ -131,7 +183,22 @@ type TableScheme struct {
 	Key     []*TableColDef
 	Value   []*TableColDef
 	NameMap map[string]*TableColDef
-	Dir     directory.DirectorySubspace
+	Dir     Dir
+	Indexes []IndexDef
+
+	// CDCEnabled is true once EnableCDC has turned on change-data-capture
+	// for this table; see cdc.go.
+	CDCEnabled bool
+
+	// TTL is the retention window set by `WITH ttl = '...'` at CREATE TABLE
+	// time, or zero if the table has no retention policy. See ttl.go.
+	TTL time.Duration
+
+	// valueSlots is the number of value-column Pos slots ever assigned,
+	// dropped columns included, and therefore how many elements encodeRow
+	// must pack into a row's value tuple so every live column's Pos still
+	// lands at the right index. Set by fill.
+	valueSlots uint32
 }
 
 func NewTableScheme(cols []TableColDef, key []int) (tbl TableScheme) {
@@ -144,8 +211,16 @@ func NewTableScheme(cols []TableColDef, key []int) (tbl TableScheme) {
 	return
 }
 
+// fill rebuilds NameMap and Value from Cols/Key, and assigns PosCol/Pos.
+// Key columns keep the Pos they're declared in (tbl.Key never reorders).
+// Value columns are assigned Pos by walking Cols in order and counting
+// every non-key column seen so far, dropped ones included: since dropColumn
+// tombstones a column in place instead of cutting it out of Cols, that walk
+// produces the same Pos for the same surviving column on every call, no
+// matter how many columns before it have since been dropped. Reusing a
+// freed Pos here would make rows written before the drop decode with the
+// wrong bytes for whatever column used to follow it (see TableColDef.Pos).
 func (self *TableScheme) fill() {
-	self.Value = make([]*TableColDef, len(self.Cols)-len(self.Key))
 	for i := 0; i < len(self.Key); i++ {
 		col := self.Key[i]
 		col.IsKey = true
@@ -153,16 +228,23 @@ func (self *TableScheme) fill() {
 	}
 	n := 0
 	self.NameMap = make(map[string]*TableColDef)
+	self.Value = nil
 	for i := 0; i < len(self.Cols); i++ {
 		col := &self.Cols[i]
 		col.PosCol = uint32(i)
-		self.NameMap[col.Name] = col
-		if !col.IsKey {
-			self.Value[n] = col
-			col.Pos = uint32(n)
-			n++
+		if col.IsKey {
+			self.NameMap[col.Name] = col
+			continue
 		}
+		col.Pos = uint32(n)
+		n++
+		if col.Dropped {
+			continue
+		}
+		self.Value = append(self.Value, col)
+		self.NameMap[col.Name] = col
 	}
+	self.valueSlots = uint32(n)
 }
 
 func (self *TableScheme) encode() []byte {
@@ -181,6 +263,19 @@ func (self *TableScheme) encode() []byte {
 		binary.BigEndian.PutUint32(bn, uint32(k.PosCol))
 		out = append(out, bn...)
 	}
+	binary.BigEndian.PutUint32(bn, uint32(len(self.Indexes)))
+	out = append(out, bn...)
+	for _, idx := range self.Indexes {
+		out = append(out, idx.encode()...)
+	}
+	if self.CDCEnabled {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	bn8 := make([]byte, 8)
+	binary.BigEndian.PutUint64(bn8, uint64(self.TTL))
+	out = append(out, bn8...)
 	return out
 }
 
@@ -203,11 +298,26 @@ func decodeTableScheme(bytes []byte) TableScheme {
 	var tbl TableScheme
 	tbl.Cols = cols
 	tbl.Key = key
+	if v >= 3 {
+		n = binary.BigEndian.Uint32(bytes)
+		bytes = bytes[4:]
+		tbl.Indexes = make([]IndexDef, n)
+		for i := uint32(0); i < n; i++ {
+			bytes = decodeIndexDef(bytes, &tbl.Indexes[i], cols)
+		}
+	}
+	if v >= 4 {
+		tbl.CDCEnabled = bytes[0] != 0
+		bytes = bytes[1:]
+	}
+	if v >= 5 {
+		tbl.TTL = time.Duration(binary.BigEndian.Uint64(bytes))
+	}
 	tbl.fill()
 	return tbl
 }
 
-func CreateTable(db fdb.Transactor, dbName string, ast *AstCreateTable) (err error) {
+func CreateTable(s Storage, dbName string, ast *AstCreateTable) (err error) {
 	if dbName == "" {
 		dbName = ast.Name.DatabaseName()
 	}
@@ -215,7 +325,7 @@ func CreateTable(db fdb.Transactor, dbName string, ast *AstCreateTable) (err err
 		err = errors.New("No database name has been specified. USE a database name, or explicitly specify databasename.tablename")
 		return
 	}
-	exists1, err1 := directory.Exists(db, []string{"db", dbName})
+	exists1, err1 := s.ExistsDir([]string{"db", dbName})
 	if err1 != nil {
 		err = err1
 		return
@@ -226,7 +336,7 @@ func CreateTable(db fdb.Transactor, dbName string, ast *AstCreateTable) (err err
 	}
 	tblName := ast.Name.TableName()
 	pathTable := []string{"db", dbName, tblName}
-	exists2, err1 := directory.Exists(db, pathTable)
+	exists2, err1 := s.ExistsDir(pathTable)
 	if err1 != nil {
 		err = err1
 		return
@@ -277,43 +387,53 @@ func CreateTable(db fdb.Transactor, dbName string, ast *AstCreateTable) (err err
 		err = errors.New("PRIMARY KEY not declared")
 		return
 	}
-	_, err = db.Transact(func(tr fdb.Transaction) (ret interface{}, err error) {
-		dirTable, err2 := directory.Create(tr, pathTable, nil)
+	if ast.TTL != nil {
+		if tbl.Key[0].Type != Timestamp {
+			err = errors.New("TTL requires the first PRIMARY KEY column to be a Timestamp")
+			return
+		}
+		tbl.TTL, err = parseTTL(*ast.TTL)
+		if err != nil {
+			return
+		}
+	}
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		_, err2 := tr.CreateDir(pathTable)
 		if err2 != nil {
 			err = err2
 			return
 		}
-		dirScheme, err3 := dirTable.Create(tr, []string{"scheme"}, nil)
+		dirScheme, err3 := tr.CreateDir(append(append([]string{}, pathTable...), "scheme"))
 		if err3 != nil {
 			err = err3
 			return
 		}
 		tbl.fill()
-		tr.Set(fdb.Key(dirScheme.Bytes()), tbl.encode())
+		tr.Set(dirScheme.Bytes(), tbl.encode())
 		return
 	})
 	return
 }
 
-func openTable(db fdb.Transactor, dbName string, tblName string) (dirTable directory.DirectorySubspace, dirScheme directory.DirectorySubspace, err error) {
+func openTable(s Storage, dbName string, tblName string) (dirTable Dir, dirScheme Dir, err error) {
 	pathTable := []string{"db", dbName, tblName}
-	dirTable, err = directory.Open(db, pathTable, nil)
+	dirTable, err = s.OpenDir(pathTable)
 	if err != nil {
 		return
 	}
-	dirScheme, err = dirTable.Open(db, []string{"scheme"}, nil)
+	dirScheme, err = s.OpenDir(append(append([]string{}, pathTable...), "scheme"))
 	return
 }
 
-func DropTable(db fdb.Transactor, dbName string, tblName string) (err error) {
-	dirTable, dirScheme, err1 := openTable(db, dbName, tblName)
+func DropTable(s Storage, dbName string, tblName string) (err error) {
+	_, dirScheme, err1 := openTable(s, dbName, tblName)
 	if err1 != nil {
 		err = err1
 		return
 	}
-	_, err = db.Transact(func(tr fdb.Transaction) (ret interface{}, err error) {
-		tr.Clear(fdb.Key(dirScheme.Bytes()))
-		_, err = dirTable.Remove(tr, nil)
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		tr.Clear(dirScheme.Bytes())
+		_, err = tr.RemoveDir([]string{"db", dbName, tblName})
 		return
 	})
 	return
@@ -343,26 +463,33 @@ func parseDataType(typeStr string) DataType {
 	return UnknowDataType
 }
 
-func GetTableScheme(db fdb.Transactor, dbName string, tblName string) (tbl TableScheme, err error) {
+func GetTableScheme(s Storage, dbName string, tblName string) (tbl TableScheme, err error) {
 	fullName := dbName + "." + tblName
-	tmp, _ := TableSchemeMap.Load(fullName)
+	tmp, _ := s.SchemeCache().Load(fullName)
 	if tmp != nil {
 		tbl = tmp.(TableScheme)
 		return
 	}
-	dirTable, dirScheme, err1 := openTable(db, dbName, tblName)
+	dirTable, dirScheme, err1 := openTable(s, dbName, tblName)
 	if err1 != nil {
 		err = err1
 		return
 	}
-	_, err = db.Transact(func(tr fdb.Transaction) (ret interface{}, err error) {
-		tbl = decodeTableScheme(tr.Get(fdb.Key(dirScheme.Bytes())).MustGet())
+	_, err = s.Transact(func(tr Txn) (ret interface{}, err error) {
+		tbl = decodeTableScheme(tr.Get(dirScheme.Bytes()))
 		return
 	})
 	if err != nil {
 		return
 	}
 	tbl.Dir = dirTable
-	TableSchemeMap.Store(fullName, dirTable)
+	for i := range tbl.Indexes {
+		idx := &tbl.Indexes[i]
+		idx.Dir, err = s.OpenDir([]string{"db", dbName, tblName, "index", idx.Name})
+		if err != nil {
+			return
+		}
+	}
+	s.SchemeCache().Store(fullName, tbl)
 	return
 }
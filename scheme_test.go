@@ -0,0 +1,103 @@
+package opentick
+
+import "testing"
+
+func TestZeroValueForType(t *testing.T) {
+	cases := []struct {
+		t    DataType
+		want interface{}
+	}{
+		{TinyInt, int64(0)},
+		{BigInt, int64(0)},
+		{Timestamp, int64(0)},
+		{Double, float64(0)},
+		{Float, float64(0)},
+		{Boolean, false},
+		{Text, ""},
+	}
+	for _, c := range cases {
+		if got := zeroValueForType(c.t); got != c.want {
+			t.Errorf("zeroValueForType(%v) = %#v, want %#v", c.t, got, c.want)
+		}
+	}
+}
+
+func TestDatabaseLifecycle(t *testing.T) {
+	s := NewMemStorage()
+	if err := CreateDatabase(s, "db1"); err != nil {
+		t.Fatalf("CreateDatabase: %v", err)
+	}
+	if err := CreateDatabase(s, "db1"); err == nil {
+		t.Fatal("expected error creating an already-existing database")
+	}
+	if _, err := ListTables(s, "nope"); err == nil {
+		t.Fatal("expected error listing tables of a database that doesn't exist")
+	}
+	if err := DropDatabase(s, "db1"); err != nil {
+		t.Fatalf("DropDatabase: %v", err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "db1"}); exists {
+		t.Fatal("database directory still exists after DropDatabase")
+	}
+}
+
+// createTestTable builds a table's directories and scheme directly through
+// Storage/Txn, the same way CreateTable does internally, without going
+// through the AstCreateTable parser this snapshot doesn't include.
+func createTestTable(t *testing.T, s Storage, dbName, tblName string, tbl TableScheme) {
+	t.Helper()
+	pathTable := []string{"db", dbName, tblName}
+	_, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if _, err := tr.CreateDir(pathTable); err != nil {
+			return nil, err
+		}
+		dirScheme, err := tr.CreateDir(append(append([]string{}, pathTable...), "scheme"))
+		if err != nil {
+			return nil, err
+		}
+		tbl.fill()
+		tr.Set(dirScheme.Bytes(), tbl.encode())
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("createTestTable: %v", err)
+	}
+}
+
+func TestMigrateNoOpOnCurrentSchemeVersion(t *testing.T) {
+	s := NewMemStorage()
+	if err := CreateDatabase(s, "db1"); err != nil {
+		t.Fatalf("CreateDatabase: %v", err)
+	}
+	cols := []TableColDef{NewTableColDef("id", Int), NewTableColDef("val", Text)}
+	tbl := NewTableScheme(cols, []int{0})
+	createTestTable(t, s, "db1", "t1", tbl)
+
+	upgraded, err := Migrate(s, "db1")
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if upgraded != 0 {
+		t.Fatalf("Migrate upgraded = %d, want 0 for a table already at schemeVersion", upgraded)
+	}
+}
+
+// TestDecodeTableColDefPreV2 confirms a column decoded from a scheme written
+// before ALTER TABLE existed (no AddedVersion tag on disk) defaults
+// AddedVersion to 1, so every column on such a table counts as present from
+// the start.
+func TestDecodeTableColDefPreV2(t *testing.T) {
+	col := NewTableColDef("id", Int)
+	var out TableColDef
+	// Pre-v2 wire format: name-length, name, type - no AddedVersion tag and
+	// no Dropped byte.
+	raw := col.encode()
+	raw = raw[:len(raw)-5]
+	decodeTableColDef(raw, &out, 1)
+	if out.AddedVersion != 1 {
+		t.Fatalf("AddedVersion = %d, want 1", out.AddedVersion)
+	}
+	if out.Name != "id" || out.Type != Int {
+		t.Fatalf("decoded column = %+v, want name=id type=Int", out)
+	}
+}
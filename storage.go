@@ -0,0 +1,71 @@
+package opentick
+
+import "sync"
+
+// KeyValue is a single key/value pair as returned by Txn.GetRange.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Dir identifies a directory (subspace) within a Storage. Keys written
+// through a Dir are namespaced by the underlying Storage implementation so
+// that two directories never collide, mirroring fdb/directory.DirectorySubspace
+// closely enough that callers can keep treating a Dir as an opaque key prefix.
+type Dir interface {
+	Bytes() []byte
+}
+
+// Txn is a single atomic unit of work against a Storage. All key/value
+// operations are scoped to the full, absolute key - callers are expected to
+// prefix keys with a Dir's Bytes() themselves, exactly as they already do
+// against fdb.Transaction.
+//
+// Txn also exposes the same directory operations as Storage. Code running
+// inside a Storage.Transact callback must call these, not the ones on the
+// enclosing Storage: the Storage-level methods always open their own
+// transaction against the backend, which deadlocks against bolt/leveldb's
+// single writer lock when called from inside an already-open Transact, and
+// breaks atomicity against FDB by committing independently of (and
+// possibly before) the outer transaction.
+type Txn interface {
+	Get(key []byte) []byte
+	Set(key []byte, value []byte)
+	Clear(key []byte)
+	GetRange(begin []byte, end []byte) []KeyValue
+
+	CreateDir(path []string) (Dir, error)
+	OpenDir(path []string) (Dir, error)
+	RemoveDir(path []string) (bool, error)
+	ExistsDir(path []string) (bool, error)
+	ListDir(path []string) ([]string, error)
+}
+
+// Storage abstracts the durable key/value backend used by the schema and
+// query layers so they can run against FoundationDB, an embedded store such
+// as BoltDB or LevelDB, or an in-memory map for unit tests. Directory paths
+// are always given in full, the same way callers already built
+// []string{"db", dbName, tblName} for fdb's directory layer.
+//
+// CreateDir/OpenDir/RemoveDir/ExistsDir/ListDir here are for use outside of
+// a Transact call; from inside one, use the Txn passed to the callback
+// instead (see the Txn doc comment).
+type Storage interface {
+	Transact(fn func(Txn) (interface{}, error)) (interface{}, error)
+	CreateDir(path []string) (Dir, error)
+	OpenDir(path []string) (Dir, error)
+	RemoveDir(path []string) (bool, error)
+	ExistsDir(path []string) (bool, error)
+	ListDir(path []string) ([]string, error)
+
+	// SchemeCache returns the TableScheme cache owned by this Storage
+	// instance, so multiple Storages never share or collide on entries.
+	SchemeCache() *sync.Map
+}
+
+// dirBytes is the common Dir implementation shared by every Storage adapter.
+type dirBytes []byte
+
+func (self dirBytes) Bytes() []byte {
+	return []byte(self)
+}
@@ -0,0 +1,312 @@
+package opentick
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// boltStorage adapts a BoltDB handle to the Storage interface. Directories
+// are tracked as nested buckets purely for CreateDir/OpenDir/ListDir
+// bookkeeping; actual row data is kept in one flat top-level bucket keyed by
+// the same fully-qualified binary keys (Dir.Bytes() plus any packed suffix)
+// that callers already build against fdb, so GetRange can use a plain
+// cursor scan.
+type boltStorage struct {
+	db     *bolt.DB
+	scheme sync.Map
+}
+
+var boltDataBucket = []byte("data")
+
+// NewBoltStorage wraps db as a Storage. BoltDB gives opentick a durable,
+// embedded, single-process backend with real ACID transactions, unlike
+// NewMemStorage.
+func NewBoltStorage(db *bolt.DB) Storage {
+	return &boltStorage{db: db}
+}
+
+func boltDirBucket(tx *bolt.Tx, path []string, create bool) (*bolt.Bucket, error) {
+	var bucket *bolt.Bucket
+	for _, name := range path {
+		var next *bolt.Bucket
+		if bucket == nil {
+			next = tx.Bucket([]byte(name))
+			if next == nil && create {
+				var err error
+				next, err = tx.CreateBucket([]byte(name))
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			next = bucket.Bucket([]byte(name))
+			if next == nil && create {
+				var err error
+				next, err = bucket.CreateBucket([]byte(name))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if next == nil {
+			return nil, errors.New("Directory " + strings.Join(path, "/") + " does not exist")
+		}
+		bucket = next
+	}
+	return bucket, nil
+}
+
+func (self *boltStorage) CreateDir(path []string) (dir Dir, err error) {
+	err = self.db.Update(func(tx *bolt.Tx) error {
+		if _, openErr := boltDirBucket(tx, path, false); openErr == nil {
+			return errors.New("Directory " + strings.Join(path, "/") + " already exists")
+		}
+		_, createErr := boltDirBucket(tx, path, true)
+		return createErr
+	})
+	if err == nil {
+		dir = dirBytes(strings.Join(path, "/") + "/")
+	}
+	return
+}
+
+func (self *boltStorage) OpenDir(path []string) (dir Dir, err error) {
+	err = self.db.View(func(tx *bolt.Tx) error {
+		_, openErr := boltDirBucket(tx, path, false)
+		return openErr
+	})
+	if err == nil {
+		dir = dirBytes(strings.Join(path, "/") + "/")
+	}
+	return
+}
+
+func (self *boltStorage) ExistsDir(path []string) (exists bool, err error) {
+	err = self.db.View(func(tx *bolt.Tx) error {
+		_, openErr := boltDirBucket(tx, path, false)
+		exists = openErr == nil
+		return nil
+	})
+	return
+}
+
+func (self *boltStorage) RemoveDir(path []string) (removed bool, err error) {
+	if len(path) == 0 {
+		err = errors.New("Cannot remove the root directory")
+		return
+	}
+	err = self.db.Update(func(tx *bolt.Tx) error {
+		parent, openErr := boltDirBucket(tx, path[:len(path)-1], false)
+		if openErr != nil {
+			return nil
+		}
+		name := []byte(path[len(path)-1])
+		if parent == nil {
+			if tx.Bucket(name) == nil {
+				return nil
+			}
+			removed = true
+			if delErr := boltRemoveData(tx, path); delErr != nil {
+				return delErr
+			}
+			return tx.DeleteBucket(name)
+		}
+		if parent.Bucket(name) == nil {
+			return nil
+		}
+		removed = true
+		if delErr := boltRemoveData(tx, path); delErr != nil {
+			return delErr
+		}
+		return parent.DeleteBucket(name)
+	})
+	return
+}
+
+// boltRemoveData deletes every row/index/scheme key under the directory
+// being dropped from the shared data bucket. Directories are only bookkept
+// as nested buckets in boltDirBucket; dropping those buckets says nothing
+// about the flat data bucket the actual rows live in, so this has to be done
+// as a separate cursor scan over the same prefix the directory's own
+// Dir.Bytes() produces (which is why CreateDir/OpenDir bake a trailing "/"
+// into that prefix: it keeps this scan from also matching a sibling
+// directory, e.g. "t1" matching "t10").
+func boltRemoveData(tx *bolt.Tx, path []string) error {
+	data := tx.Bucket(boltDataBucket)
+	if data == nil {
+		return nil
+	}
+	prefix := []byte(strings.Join(path, "/") + "/")
+	c := data.Cursor()
+	var keys [][]byte
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte{}, k...))
+	}
+	for _, k := range keys {
+		if err := data.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *boltStorage) ListDir(path []string) (names []string, err error) {
+	err = self.db.View(func(tx *bolt.Tx) error {
+		bucket, openErr := boltDirBucket(tx, path, false)
+		if openErr != nil {
+			return openErr
+		}
+		// Nested buckets are the entries whose value is nil.
+		return bucket.ForEach(func(name []byte, v []byte) error {
+			if v == nil {
+				names = append(names, string(name))
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (self *boltStorage) SchemeCache() *sync.Map {
+	return &self.scheme
+}
+
+type boltTxn struct {
+	tx   *bolt.Tx
+	data *bolt.Bucket
+}
+
+func (self *boltTxn) ensureData(create bool) *bolt.Bucket {
+	if self.data != nil {
+		return self.data
+	}
+	if create {
+		self.data, _ = self.tx.CreateBucketIfNotExists(boltDataBucket)
+	} else {
+		self.data = self.tx.Bucket(boltDataBucket)
+	}
+	return self.data
+}
+
+func (self *boltTxn) Get(key []byte) []byte {
+	data := self.ensureData(false)
+	if data == nil {
+		return nil
+	}
+	return data.Get(key)
+}
+
+func (self *boltTxn) Set(key []byte, value []byte) {
+	data := self.ensureData(true)
+	data.Put(key, value)
+}
+
+func (self *boltTxn) Clear(key []byte) {
+	data := self.ensureData(false)
+	if data != nil {
+		data.Delete(key)
+	}
+}
+
+func (self *boltTxn) GetRange(begin []byte, end []byte) (out []KeyValue) {
+	data := self.ensureData(false)
+	if data == nil {
+		return
+	}
+	c := data.Cursor()
+	for k, v := c.Seek(begin); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+		out = append(out, KeyValue{Key: append([]byte{}, k...), Value: append([]byte{}, v...)})
+	}
+	return
+}
+
+// CreateDir and the directory methods below reuse self.tx, the *bolt.Tx the
+// enclosing Transact already opened, instead of calling self.db.Update/View
+// again: BoltDB's writer lock is held for the whole Update call and is not
+// reentrant, so a second Update from the same goroutine would block forever
+// waiting on a lock it already holds.
+func (self *boltTxn) CreateDir(path []string) (dir Dir, err error) {
+	if _, openErr := boltDirBucket(self.tx, path, false); openErr == nil {
+		err = errors.New("Directory " + strings.Join(path, "/") + " already exists")
+		return
+	}
+	_, err = boltDirBucket(self.tx, path, true)
+	if err == nil {
+		dir = dirBytes(strings.Join(path, "/") + "/")
+	}
+	return
+}
+
+func (self *boltTxn) OpenDir(path []string) (dir Dir, err error) {
+	_, err = boltDirBucket(self.tx, path, false)
+	if err == nil {
+		dir = dirBytes(strings.Join(path, "/") + "/")
+	}
+	return
+}
+
+func (self *boltTxn) ExistsDir(path []string) (exists bool, err error) {
+	_, openErr := boltDirBucket(self.tx, path, false)
+	exists = openErr == nil
+	return
+}
+
+func (self *boltTxn) RemoveDir(path []string) (removed bool, err error) {
+	if len(path) == 0 {
+		err = errors.New("Cannot remove the root directory")
+		return
+	}
+	parent, openErr := boltDirBucket(self.tx, path[:len(path)-1], false)
+	if openErr != nil {
+		return
+	}
+	name := []byte(path[len(path)-1])
+	if parent == nil {
+		if self.tx.Bucket(name) == nil {
+			return
+		}
+		removed = true
+		if err = boltRemoveData(self.tx, path); err != nil {
+			return
+		}
+		err = self.tx.DeleteBucket(name)
+		return
+	}
+	if parent.Bucket(name) == nil {
+		return
+	}
+	removed = true
+	if err = boltRemoveData(self.tx, path); err != nil {
+		return
+	}
+	err = parent.DeleteBucket(name)
+	return
+}
+
+func (self *boltTxn) ListDir(path []string) (names []string, err error) {
+	bucket, openErr := boltDirBucket(self.tx, path, false)
+	if openErr != nil {
+		err = openErr
+		return
+	}
+	err = bucket.ForEach(func(name []byte, v []byte) error {
+		if v == nil {
+			names = append(names, string(name))
+		}
+		return nil
+	})
+	return
+}
+
+func (self *boltStorage) Transact(fn func(Txn) (interface{}, error)) (ret interface{}, err error) {
+	err = self.db.Update(func(tx *bolt.Tx) error {
+		var txErr error
+		ret, txErr = fn(&boltTxn{tx: tx})
+		return txErr
+	})
+	return
+}
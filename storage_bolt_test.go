@@ -0,0 +1,128 @@
+package opentick
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func openTestBoltStorage(t *testing.T) Storage {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewBoltStorage(db)
+}
+
+func TestBoltStorageDirLifecycle(t *testing.T) {
+	s := openTestBoltStorage(t)
+	if _, err := s.CreateDir([]string{"db", "t"}); err != nil {
+		t.Fatalf("CreateDir: %v", err)
+	}
+	if exists, err := s.ExistsDir([]string{"db", "t"}); err != nil || !exists {
+		t.Fatalf("ExistsDir after create = %v, %v", exists, err)
+	}
+	if _, err := s.CreateDir([]string{"db", "t"}); err == nil {
+		t.Fatal("expected error creating an already-existing directory")
+	}
+	names, err := s.ListDir([]string{"db"})
+	if err != nil || len(names) != 1 || names[0] != "t" {
+		t.Fatalf("ListDir = %v, %v", names, err)
+	}
+	if removed, err := s.RemoveDir([]string{"db", "t"}); err != nil || !removed {
+		t.Fatalf("RemoveDir = %v, %v", removed, err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "t"}); exists {
+		t.Fatal("directory still exists after RemoveDir")
+	}
+}
+
+// TestBoltRemoveDirClearsData exercises the chunk0-1 fix: dropping a
+// directory must also clear the rows/index entries it owns out of the
+// shared data bucket, not just the bookkeeping bucket structure.
+func TestBoltRemoveDirClearsData(t *testing.T) {
+	s := openTestBoltStorage(t)
+	dir, err := s.CreateDir([]string{"db", "db1", "t1"})
+	if err != nil {
+		t.Fatalf("CreateDir: %v", err)
+	}
+	key := append(append([]byte{}, dir.Bytes()...), "row1"...)
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		tr.Set(key, []byte("v"))
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if _, err := s.RemoveDir([]string{"db", "db1", "t1"}); err != nil {
+		t.Fatalf("RemoveDir: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if got := tr.Get(key); got != nil {
+			t.Fatalf("row data still present after RemoveDir: %q", got)
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+}
+
+// TestBoltRemoveDirLeavesSiblingData makes sure dropping "t1" can't also
+// sweep up a sibling directory whose name happens to share a literal
+// prefix, e.g. "t10".
+func TestBoltRemoveDirLeavesSiblingData(t *testing.T) {
+	s := openTestBoltStorage(t)
+	dir1, err := s.CreateDir([]string{"db", "db1", "t1"})
+	if err != nil {
+		t.Fatalf("CreateDir t1: %v", err)
+	}
+	dir10, err := s.CreateDir([]string{"db", "db1", "t10"})
+	if err != nil {
+		t.Fatalf("CreateDir t10: %v", err)
+	}
+	key1 := append(append([]byte{}, dir1.Bytes()...), "row"...)
+	key10 := append(append([]byte{}, dir10.Bytes()...), "row"...)
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		tr.Set(key1, []byte("v1"))
+		tr.Set(key10, []byte("v10"))
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if _, err := s.RemoveDir([]string{"db", "db1", "t1"}); err != nil {
+		t.Fatalf("RemoveDir: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if got := tr.Get(key10); string(got) != "v10" {
+			t.Fatalf("sibling t10 data = %q, want v10 (dropping t1 must not touch it)", got)
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+}
+
+func TestBoltTxnDirOpsInsideTransact(t *testing.T) {
+	s := openTestBoltStorage(t)
+	_, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if _, err := tr.CreateDir([]string{"db"}); err != nil {
+			return nil, err
+		}
+		if _, err := tr.CreateDir([]string{"db", "t"}); err != nil {
+			return nil, err
+		}
+		exists, err := tr.ExistsDir([]string{"db", "t"})
+		if err != nil || !exists {
+			t.Fatalf("ExistsDir inside Transact = %v, %v", exists, err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "t"}); !exists {
+		t.Fatal("directory created inside Transact did not persist")
+	}
+}
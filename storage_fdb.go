@@ -0,0 +1,128 @@
+package opentick
+
+import (
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+)
+
+// fdbStorage adapts an fdb.Transactor (a *fdb.Database or any fdb.Transactor)
+// to the Storage interface, using the directory layer for CreateDir/OpenDir
+// and friends.
+type fdbStorage struct {
+	db     fdb.Transactor
+	scheme sync.Map
+}
+
+// NewFDBStorage wraps db as a Storage backed by a real FoundationDB cluster.
+// This is what opentick used exclusively before Storage existed; every other
+// adapter exists to avoid needing one of these in tests.
+func NewFDBStorage(db fdb.Transactor) Storage {
+	return &fdbStorage{db: db}
+}
+
+func (self *fdbStorage) CreateDir(path []string) (Dir, error) {
+	dir, err := directory.Create(self.db, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dirBytes(dir.Bytes()), nil
+}
+
+func (self *fdbStorage) OpenDir(path []string) (Dir, error) {
+	dir, err := directory.Open(self.db, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dirBytes(dir.Bytes()), nil
+}
+
+func (self *fdbStorage) RemoveDir(path []string) (bool, error) {
+	return directory.Root().Remove(self.db, path)
+}
+
+func (self *fdbStorage) ExistsDir(path []string) (bool, error) {
+	return directory.Exists(self.db, path)
+}
+
+func (self *fdbStorage) ListDir(path []string) ([]string, error) {
+	dir, err := directory.Open(self.db, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dir.List(self.db, nil)
+}
+
+func (self *fdbStorage) SchemeCache() *sync.Map {
+	return &self.scheme
+}
+
+type fdbTxn struct {
+	tr fdb.Transaction
+}
+
+func (self *fdbTxn) Get(key []byte) []byte {
+	return self.tr.Get(fdb.Key(key)).MustGet()
+}
+
+func (self *fdbTxn) Set(key []byte, value []byte) {
+	self.tr.Set(fdb.Key(key), value)
+}
+
+func (self *fdbTxn) Clear(key []byte) {
+	self.tr.Clear(fdb.Key(key))
+}
+
+func (self *fdbTxn) GetRange(begin []byte, end []byte) []KeyValue {
+	kr := fdb.KeyRange{Begin: fdb.Key(begin), End: fdb.Key(end)}
+	kvs := self.tr.GetRange(kr, fdb.RangeOptions{}).GetSliceOrPanic()
+	out := make([]KeyValue, len(kvs))
+	for i, kv := range kvs {
+		out[i] = KeyValue{Key: []byte(kv.Key), Value: kv.Value}
+	}
+	return out
+}
+
+// CreateDir and the directory methods below run the directory layer against
+// self.tr rather than the fdbStorage's own db: fdb.Transaction satisfies
+// fdb.Transactor by invoking the callback directly against itself instead
+// of opening a new transaction, so these operations become part of the
+// transaction already in flight instead of committing independently.
+func (self *fdbTxn) CreateDir(path []string) (Dir, error) {
+	dir, err := directory.Create(self.tr, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dirBytes(dir.Bytes()), nil
+}
+
+func (self *fdbTxn) OpenDir(path []string) (Dir, error) {
+	dir, err := directory.Open(self.tr, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dirBytes(dir.Bytes()), nil
+}
+
+func (self *fdbTxn) RemoveDir(path []string) (bool, error) {
+	return directory.Root().Remove(self.tr, path)
+}
+
+func (self *fdbTxn) ExistsDir(path []string) (bool, error) {
+	return directory.Exists(self.tr, path)
+}
+
+func (self *fdbTxn) ListDir(path []string) ([]string, error) {
+	dir, err := directory.Open(self.tr, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dir.List(self.tr, nil)
+}
+
+func (self *fdbStorage) Transact(fn func(Txn) (interface{}, error)) (interface{}, error) {
+	return self.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		return fn(&fdbTxn{tr: tr})
+	})
+}
@@ -0,0 +1,301 @@
+package opentick
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// leveldbStorage adapts a LevelDB handle to the Storage interface. LevelDB
+// has no notion of directories or transactions, so directories are tracked
+// as entries under a reserved "\x00dir/" key prefix, and Transact is
+// serialized behind a single mutex to give callers the same one-writer-at-a-
+// time semantics they get from bolt and fdb.
+type leveldbStorage struct {
+	db     *leveldb.DB
+	mu     sync.Mutex
+	scheme sync.Map
+}
+
+var leveldbDirPrefix = []byte("\x00dir/")
+
+// NewLevelDBStorage wraps db as a Storage.
+func NewLevelDBStorage(db *leveldb.DB) Storage {
+	return &leveldbStorage{db: db}
+}
+
+func leveldbDirKey(path []string) []byte {
+	return append(append([]byte{}, leveldbDirPrefix...), []byte(strings.Join(path, "/"))...)
+}
+
+func (self *leveldbStorage) CreateDir(path []string) (dir Dir, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	// Missing parent directories are created too, as fdb's directory layer
+	// and boltStorage do.
+	for i := 1; i < len(path); i++ {
+		if err = self.db.Put(leveldbDirKey(path[:i]), []byte{1}, nil); err != nil {
+			return
+		}
+	}
+	key := leveldbDirKey(path)
+	exists, err1 := self.db.Has(key, nil)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if exists {
+		err = errors.New("Directory " + strings.Join(path, "/") + " already exists")
+		return
+	}
+	if err = self.db.Put(key, []byte{1}, nil); err != nil {
+		return
+	}
+	dir = dirBytes(strings.Join(path, "/") + "/")
+	return
+}
+
+func (self *leveldbStorage) OpenDir(path []string) (dir Dir, err error) {
+	exists, err1 := self.db.Has(leveldbDirKey(path), nil)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if !exists {
+		err = errors.New("Directory " + strings.Join(path, "/") + " does not exist")
+		return
+	}
+	dir = dirBytes(strings.Join(path, "/") + "/")
+	return
+}
+
+func (self *leveldbStorage) ExistsDir(path []string) (exists bool, err error) {
+	return self.db.Has(leveldbDirKey(path), nil)
+}
+
+func (self *leveldbStorage) RemoveDir(path []string) (removed bool, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	key := leveldbDirKey(path)
+	exists, err1 := self.db.Has(key, nil)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if !exists {
+		return
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(key)
+	prefix := append(key, '/')
+	it := self.db.NewIterator(util.BytesPrefix(prefix), nil)
+	for it.Next() {
+		batch.Delete(append([]byte{}, it.Key()...))
+	}
+	it.Release()
+	if err = it.Error(); err != nil {
+		return
+	}
+	// Dir.Bytes() always carries a trailing "/" (see CreateDir/OpenDir) so
+	// this prefix can't also match a sibling directory's data, e.g. dropping
+	// "t1" matching rows that actually belong to "t10".
+	dataPrefix := strings.TrimPrefix(string(key), string(leveldbDirPrefix)) + "/"
+	dit := self.db.NewIterator(util.BytesPrefix([]byte(dataPrefix)), nil)
+	for dit.Next() {
+		batch.Delete(append([]byte{}, dit.Key()...))
+	}
+	dit.Release()
+	if err = dit.Error(); err != nil {
+		return
+	}
+	if err = self.db.Write(batch, nil); err != nil {
+		return
+	}
+	removed = true
+	return
+}
+
+func (self *leveldbStorage) ListDir(path []string) (names []string, err error) {
+	prefix := append(leveldbDirKey(path), '/')
+	it := self.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+	seen := map[string]bool{}
+	for it.Next() {
+		rest := strings.TrimPrefix(string(it.Key()), string(prefix))
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i]
+		}
+		if rest != "" && !seen[rest] {
+			seen[rest] = true
+			names = append(names, rest)
+		}
+	}
+	err = it.Error()
+	return
+}
+
+func (self *leveldbStorage) SchemeCache() *sync.Map {
+	return &self.scheme
+}
+
+type leveldbTxn struct {
+	db      *leveldb.DB
+	batch   *leveldb.Batch
+	created map[string]bool // dirs created earlier in this same transaction
+	removed map[string]bool // dirs removed earlier in this same transaction
+}
+
+func (self *leveldbTxn) dirExists(key []byte) (bool, error) {
+	if self.created[string(key)] {
+		return true, nil
+	}
+	if self.removed[string(key)] {
+		return false, nil
+	}
+	return self.db.Has(key, nil)
+}
+
+func (self *leveldbTxn) Get(key []byte) []byte {
+	v, err := self.db.Get(key, nil)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+func (self *leveldbTxn) Set(key []byte, value []byte) {
+	self.batch.Put(key, value)
+}
+
+func (self *leveldbTxn) Clear(key []byte) {
+	self.batch.Delete(key)
+}
+
+func (self *leveldbTxn) GetRange(begin []byte, end []byte) (out []KeyValue) {
+	it := self.db.NewIterator(&util.Range{Start: begin, Limit: end}, nil)
+	defer it.Release()
+	for it.Next() {
+		out = append(out, KeyValue{Key: append([]byte{}, it.Key()...), Value: append([]byte{}, it.Value()...)})
+	}
+	return
+}
+
+// CreateDir and the directory methods below queue their writes onto
+// self.batch and track them in self.created/self.removed instead of calling
+// self.db.Put/Write directly: leveldbStorage.Transact already holds self.mu
+// for the whole callback, so taking it again here would deadlock, and
+// writing straight to self.db would be visible before the transaction
+// (and its batch) actually commits.
+func (self *leveldbTxn) CreateDir(path []string) (dir Dir, err error) {
+	key := leveldbDirKey(path)
+	exists, err1 := self.dirExists(key)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if exists {
+		err = errors.New("Directory " + strings.Join(path, "/") + " already exists")
+		return
+	}
+	if self.created == nil {
+		self.created = map[string]bool{}
+	}
+	// Missing parent directories are created too, as in
+	// leveldbStorage.CreateDir.
+	for i := 1; i <= len(path); i++ {
+		k := leveldbDirKey(path[:i])
+		self.batch.Put(k, []byte{1})
+		self.created[string(k)] = true
+		delete(self.removed, string(k))
+	}
+	dir = dirBytes(strings.Join(path, "/") + "/")
+	return
+}
+
+func (self *leveldbTxn) OpenDir(path []string) (dir Dir, err error) {
+	exists, err1 := self.dirExists(leveldbDirKey(path))
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if !exists {
+		err = errors.New("Directory " + strings.Join(path, "/") + " does not exist")
+		return
+	}
+	dir = dirBytes(strings.Join(path, "/") + "/")
+	return
+}
+
+func (self *leveldbTxn) ExistsDir(path []string) (exists bool, err error) {
+	return self.dirExists(leveldbDirKey(path))
+}
+
+func (self *leveldbTxn) RemoveDir(path []string) (removed bool, err error) {
+	key := leveldbDirKey(path)
+	exists, err1 := self.dirExists(key)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if !exists {
+		return
+	}
+	self.batch.Delete(key)
+	// See the identical comment in leveldbStorage.RemoveDir: the trailing "/"
+	// is what keeps this from also matching a sibling directory's data.
+	dataPrefix := strings.TrimPrefix(string(key), string(leveldbDirPrefix)) + "/"
+	it := self.db.NewIterator(util.BytesPrefix([]byte(dataPrefix)), nil)
+	for it.Next() {
+		self.batch.Delete(append([]byte{}, it.Key()...))
+	}
+	it.Release()
+	if err = it.Error(); err != nil {
+		return
+	}
+	if self.removed == nil {
+		self.removed = map[string]bool{}
+	}
+	self.removed[string(key)] = true
+	delete(self.created, string(key))
+	removed = true
+	return
+}
+
+func (self *leveldbTxn) ListDir(path []string) (names []string, err error) {
+	prefix := append(leveldbDirKey(path), '/')
+	it := self.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+	seen := map[string]bool{}
+	for it.Next() {
+		rest := strings.TrimPrefix(string(it.Key()), string(prefix))
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i]
+		}
+		if rest != "" && !seen[rest] && !self.removed[string(it.Key())] {
+			seen[rest] = true
+			names = append(names, rest)
+		}
+	}
+	err = it.Error()
+	return
+}
+
+// Transact serializes writers with a mutex: goleveldb has no multi-key
+// transaction primitive, only atomic batch writes, so reads inside fn see a
+// consistent snapshot only in the sense that no other Transact call can be
+// concurrently mutating the same keys.
+func (self *leveldbStorage) Transact(fn func(Txn) (interface{}, error)) (ret interface{}, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	batch := new(leveldb.Batch)
+	ret, err = fn(&leveldbTxn{db: self.db, batch: batch})
+	if err != nil {
+		return
+	}
+	err = self.db.Write(batch, nil)
+	return
+}
@@ -0,0 +1,99 @@
+package opentick
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func openTestLevelDBStorage(t *testing.T) Storage {
+	t.Helper()
+	db, err := leveldb.OpenFile(filepath.Join(t.TempDir(), "test.ldb"), nil)
+	if err != nil {
+		t.Fatalf("leveldb.OpenFile: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewLevelDBStorage(db)
+}
+
+func TestLevelDBStorageDirLifecycle(t *testing.T) {
+	s := openTestLevelDBStorage(t)
+	if _, err := s.CreateDir([]string{"db", "t"}); err != nil {
+		t.Fatalf("CreateDir: %v", err)
+	}
+	if exists, err := s.ExistsDir([]string{"db", "t"}); err != nil || !exists {
+		t.Fatalf("ExistsDir after create = %v, %v", exists, err)
+	}
+	if _, err := s.CreateDir([]string{"db", "t"}); err == nil {
+		t.Fatal("expected error creating an already-existing directory")
+	}
+	names, err := s.ListDir([]string{"db"})
+	if err != nil || len(names) != 1 || names[0] != "t" {
+		t.Fatalf("ListDir = %v, %v", names, err)
+	}
+	if removed, err := s.RemoveDir([]string{"db", "t"}); err != nil || !removed {
+		t.Fatalf("RemoveDir = %v, %v", removed, err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "t"}); exists {
+		t.Fatal("directory still exists after RemoveDir")
+	}
+}
+
+// TestLevelDBRemoveDirLeavesSiblingData is the LevelDB counterpart of the
+// bolt test with the same name: dropping "t1" must not sweep up "t10"'s
+// data just because its key happens to share a literal prefix.
+func TestLevelDBRemoveDirLeavesSiblingData(t *testing.T) {
+	s := openTestLevelDBStorage(t)
+	dir1, err := s.CreateDir([]string{"db", "db1", "t1"})
+	if err != nil {
+		t.Fatalf("CreateDir t1: %v", err)
+	}
+	dir10, err := s.CreateDir([]string{"db", "db1", "t10"})
+	if err != nil {
+		t.Fatalf("CreateDir t10: %v", err)
+	}
+	key1 := append(append([]byte{}, dir1.Bytes()...), "row"...)
+	key10 := append(append([]byte{}, dir10.Bytes()...), "row"...)
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		tr.Set(key1, []byte("v1"))
+		tr.Set(key10, []byte("v10"))
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if _, err := s.RemoveDir([]string{"db", "db1", "t1"}); err != nil {
+		t.Fatalf("RemoveDir: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if got := tr.Get(key10); string(got) != "v10" {
+			t.Fatalf("sibling t10 data = %q, want v10 (dropping t1 must not touch it)", got)
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+}
+
+func TestLevelDBTxnDirOpsInsideTransact(t *testing.T) {
+	s := openTestLevelDBStorage(t)
+	_, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if _, err := tr.CreateDir([]string{"db"}); err != nil {
+			return nil, err
+		}
+		if _, err := tr.CreateDir([]string{"db", "t"}); err != nil {
+			return nil, err
+		}
+		exists, err := tr.ExistsDir([]string{"db", "t"})
+		if err != nil || !exists {
+			t.Fatalf("ExistsDir inside Transact = %v, %v", exists, err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "t"}); !exists {
+		t.Fatal("directory created inside Transact did not persist")
+	}
+}
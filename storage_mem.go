@@ -0,0 +1,213 @@
+package opentick
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memStorage is an in-process Storage backed by a map and a RWMutex. It
+// exists so opentick's query/schema layer can be exercised in unit tests
+// without standing up a FoundationDB cluster.
+type memStorage struct {
+	mu     sync.RWMutex
+	dirs   map[string]bool
+	data   map[string][]byte
+	scheme sync.Map
+}
+
+// NewMemStorage creates a Storage that keeps everything in memory. It is not
+// durable and is intended for tests only.
+func NewMemStorage() Storage {
+	return &memStorage{
+		dirs: map[string]bool{"": true},
+		data: map[string][]byte{},
+	}
+}
+
+func memDirKey(path []string) string {
+	return "/" + strings.Join(path, "/")
+}
+
+func (self *memStorage) parentDir(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return memDirKey(path[:len(path)-1])
+}
+
+func (self *memStorage) CreateDir(path []string) (dir Dir, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	key := memDirKey(path)
+	if self.dirs[key] {
+		err = errors.New("Directory " + strings.Join(path, "/") + " already exists")
+		return
+	}
+	// Missing parent directories are created too, as fdb's directory layer
+	// and boltStorage do.
+	for i := 1; i < len(path); i++ {
+		self.dirs[memDirKey(path[:i])] = true
+	}
+	self.dirs[key] = true
+	dir = dirBytes(key + "/")
+	return
+}
+
+func (self *memStorage) OpenDir(path []string) (dir Dir, err error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	key := memDirKey(path)
+	if !self.dirs[key] {
+		err = errors.New("Directory " + strings.Join(path, "/") + " does not exist")
+		return
+	}
+	dir = dirBytes(key + "/")
+	return
+}
+
+func (self *memStorage) ExistsDir(path []string) (exists bool, err error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	exists = self.dirs[memDirKey(path)]
+	return
+}
+
+func (self *memStorage) RemoveDir(path []string) (removed bool, err error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	key := memDirKey(path)
+	if !self.dirs[key] {
+		return
+	}
+	prefix := key + "/"
+	for k := range self.dirs {
+		if k == key || strings.HasPrefix(k, prefix) {
+			delete(self.dirs, k)
+		}
+	}
+	// Dir.Bytes() always carries a trailing "/" (see CreateDir/OpenDir) so
+	// that it can be used as an unambiguous prefix here: without it, dropping
+	// "t1" would also match row/index keys belonging to a sibling "t10".
+	dataPrefix := []byte(key + "/")
+	for k := range self.data {
+		if strings.HasPrefix(k, string(dataPrefix)) {
+			delete(self.data, k)
+		}
+	}
+	removed = true
+	return
+}
+
+func (self *memStorage) ListDir(path []string) (names []string, err error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	key := memDirKey(path)
+	if !self.dirs[key] {
+		err = errors.New("Directory " + strings.Join(path, "/") + " does not exist")
+		return
+	}
+	prefix := key + "/"
+	seen := map[string]bool{}
+	for k := range self.dirs {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i]
+		}
+		if rest != "" && !seen[rest] {
+			seen[rest] = true
+			names = append(names, rest)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+func (self *memStorage) SchemeCache() *sync.Map {
+	return &self.scheme
+}
+
+type memTxn struct {
+	s *memStorage
+}
+
+func (self *memTxn) Get(key []byte) []byte {
+	self.s.mu.RLock()
+	defer self.s.mu.RUnlock()
+	v, ok := self.s.data[string(key)]
+	if !ok {
+		return nil
+	}
+	out := make([]byte, len(v))
+	copy(out, v)
+	return out
+}
+
+func (self *memTxn) Set(key []byte, value []byte) {
+	self.s.mu.Lock()
+	defer self.s.mu.Unlock()
+	v := make([]byte, len(value))
+	copy(v, value)
+	self.s.data[string(key)] = v
+}
+
+func (self *memTxn) Clear(key []byte) {
+	self.s.mu.Lock()
+	defer self.s.mu.Unlock()
+	delete(self.s.data, string(key))
+}
+
+func (self *memTxn) GetRange(begin []byte, end []byte) (out []KeyValue) {
+	self.s.mu.RLock()
+	defer self.s.mu.RUnlock()
+	var keys []string
+	for k := range self.s.data {
+		if k >= string(begin) && k < string(end) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, KeyValue{Key: []byte(k), Value: self.s.data[k]})
+	}
+	return
+}
+
+// CreateDir and the directory methods below simply delegate to the
+// identically named memStorage methods: unlike bolt/leveldb, Transact here
+// never holds self.s.mu for the duration of the callback (each op takes and
+// releases its own lock), so there is no reentrant-lock hazard in calling
+// them from inside a transaction. They exist on memTxn so callers can use
+// the same tr.CreateDir/tr.RemoveDir call sites across every Storage
+// implementation.
+func (self *memTxn) CreateDir(path []string) (Dir, error) {
+	return self.s.CreateDir(path)
+}
+
+func (self *memTxn) OpenDir(path []string) (Dir, error) {
+	return self.s.OpenDir(path)
+}
+
+func (self *memTxn) RemoveDir(path []string) (bool, error) {
+	return self.s.RemoveDir(path)
+}
+
+func (self *memTxn) ExistsDir(path []string) (bool, error) {
+	return self.s.ExistsDir(path)
+}
+
+func (self *memTxn) ListDir(path []string) ([]string, error) {
+	return self.s.ListDir(path)
+}
+
+// Transact runs fn directly, without holding any lock for its duration: each
+// Txn operation takes and releases the storage's lock on its own. memStorage
+// has no real transaction isolation or atomicity; this is sufficient for the
+// sequential access patterns exercised by unit tests.
+func (self *memStorage) Transact(fn func(Txn) (interface{}, error)) (interface{}, error) {
+	return fn(&memTxn{s: self})
+}
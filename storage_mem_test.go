@@ -0,0 +1,91 @@
+package opentick
+
+import "testing"
+
+func TestMemStorageDirLifecycle(t *testing.T) {
+	s := NewMemStorage()
+	if _, err := s.CreateDir([]string{"db", "t"}); err != nil {
+		t.Fatalf("CreateDir: %v", err)
+	}
+	if exists, err := s.ExistsDir([]string{"db", "t"}); err != nil || !exists {
+		t.Fatalf("ExistsDir after create = %v, %v", exists, err)
+	}
+	if _, err := s.CreateDir([]string{"db", "t"}); err == nil {
+		t.Fatal("expected error creating an already-existing directory")
+	}
+	if _, err := s.CreateDir([]string{"db", "missing", "tbl"}); err == nil {
+		t.Fatal("expected error creating a directory whose parent doesn't exist")
+	}
+	names, err := s.ListDir([]string{"db"})
+	if err != nil || len(names) != 1 || names[0] != "t" {
+		t.Fatalf("ListDir = %v, %v", names, err)
+	}
+	if removed, err := s.RemoveDir([]string{"db", "t"}); err != nil || !removed {
+		t.Fatalf("RemoveDir = %v, %v", removed, err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "t"}); exists {
+		t.Fatal("directory still exists after RemoveDir")
+	}
+}
+
+// TestMemTxnDirOpsInsideTransact exercises the chunk0-1 fix: directory
+// operations must be usable from inside a Transact callback via the Txn
+// passed to it, not just from the outer Storage.
+func TestMemTxnDirOpsInsideTransact(t *testing.T) {
+	s := NewMemStorage()
+	_, err := s.Transact(func(tr Txn) (interface{}, error) {
+		if _, err := tr.CreateDir([]string{"db"}); err != nil {
+			return nil, err
+		}
+		if _, err := tr.CreateDir([]string{"db", "t"}); err != nil {
+			return nil, err
+		}
+		exists, err := tr.ExistsDir([]string{"db", "t"})
+		if err != nil || !exists {
+			t.Fatalf("ExistsDir inside Transact = %v, %v", exists, err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if exists, _ := s.ExistsDir([]string{"db", "t"}); !exists {
+		t.Fatal("directory created inside Transact did not persist")
+	}
+}
+
+func TestMemTxnGetSetClear(t *testing.T) {
+	s := NewMemStorage()
+	key, value := []byte("k"), []byte("v")
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		tr.Set(key, value)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	var got []byte
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		got = tr.Get(key)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if string(got) != "v" {
+		t.Fatalf("Get = %q, want %q", got, "v")
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		tr.Clear(key)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if _, err := s.Transact(func(tr Txn) (interface{}, error) {
+		got = tr.Get(key)
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("Transact: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("Get after Clear = %q, want nil", got)
+	}
+}
@@ -0,0 +1,124 @@
+package opentick
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// parseTTL turns a `WITH ttl = '...'` literal into a duration. Besides the
+// units time.ParseDuration already understands (h, m, s, ...), it accepts a
+// plain day count (e.g. "30d"), since tick data retention is almost always
+// expressed in days.
+func parseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, errors.New("Invalid ttl " + s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// expireChunkRows bounds how many rows Expire clears per transaction, to
+// stay comfortably under FoundationDB's 10MB/5s transaction limits without
+// having to track the actual byte size of what it's deleting.
+const expireChunkRows = 10000
+
+// Expire clears every row of dbName.tblName whose Timestamp key column is
+// older than tbl.TTL relative to now, chunked across multiple transactions
+// so a table with years of backlog doesn't blow FDB's transaction limits in
+// one shot. It is a no-op if the table has no TTL configured.
+func Expire(db fdb.Transactor, dbName, tblName string, now time.Time) (deleted int, err error) {
+	s := NewFDBStorage(db)
+	tbl, err1 := GetTableScheme(s, dbName, tblName)
+	if err1 != nil {
+		err = err1
+		return
+	}
+	if tbl.TTL == 0 {
+		return
+	}
+	cutoffNanos := now.Add(-tbl.TTL).UnixNano()
+	cutoffKey := append(append([]byte{}, tbl.Dir.Bytes()...), tuple.Tuple{cutoffNanos}.Pack()...)
+	begin := append([]byte{}, tbl.Dir.Bytes()...)
+	for {
+		var n int
+		var lastKey []byte
+		_, txErr := db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			kr := fdb.KeyRange{Begin: fdb.Key(begin), End: fdb.Key(cutoffKey)}
+			kvs := tr.GetRange(kr, fdb.RangeOptions{Limit: expireChunkRows, Mode: fdb.StreamingModeWantAll}).GetSliceOrPanic()
+			n = len(kvs)
+			if n == 0 {
+				return nil, nil
+			}
+			lastKey = append([]byte{}, []byte(kvs[n-1].Key)...)
+			tr.ClearRange(fdb.KeyRange{Begin: fdb.Key(begin), End: fdb.Key(append(append([]byte{}, lastKey...), 0x00))})
+			return nil, nil
+		})
+		if txErr != nil {
+			err = txErr
+			return
+		}
+		deleted += n
+		if n < expireChunkRows {
+			break
+		}
+		begin = append(append([]byte{}, lastKey...), 0x00)
+	}
+	return
+}
+
+// StartRetentionLoop periodically walks every database and invokes Expire
+// on any table whose scheme carries a non-zero TTL, so operators running
+// tick data don't need an external cron job for retention. The loop stops
+// when ctx is cancelled. onError is called, if non-nil, with every error
+// Expire returns for a given table; sweepRetention itself never stops the
+// loop over an individual table's failure.
+func StartRetentionLoop(ctx context.Context, db fdb.Transactor, interval time.Duration, onError func(dbName, tblName string, err error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepRetention(db, onError)
+			}
+		}
+	}()
+}
+
+func sweepRetention(db fdb.Transactor, onError func(dbName, tblName string, err error)) {
+	s := NewFDBStorage(db)
+	dbNames, err := s.ListDir([]string{"db"})
+	if err != nil {
+		return
+	}
+	for _, dbName := range dbNames {
+		tables, err := ListTables(s, dbName)
+		if err != nil {
+			continue
+		}
+		for _, tblName := range tables {
+			tbl, err := GetTableScheme(s, dbName, tblName)
+			if err != nil || tbl.TTL == 0 {
+				continue
+			}
+			if _, err := Expire(db, dbName, tblName, time.Now()); err != nil && onError != nil {
+				onError(dbName, tblName, err)
+			}
+		}
+	}
+}
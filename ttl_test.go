@@ -0,0 +1,37 @@
+package opentick
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"1h", time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"xd", 0, true},
+		{"not-a-duration", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseTTL(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseTTL(%q) = %v, want error", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTTL(%q) unexpected error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseTTL(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}